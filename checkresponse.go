@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 )
 
@@ -42,16 +41,33 @@ func (e *HTTPError) Unmarshal(v interface{}) error {
 }
 
 func checkResponse(r *http.Response) error {
+	return checkResponseWithLimit(r, 0)
+}
+
+// checkResponseWithLimit works like checkResponse, reading at most
+// maxBodySize bytes of the error body (0 means no limit). If the error body
+// is larger, Raw contains the truncated body and the error also wraps a
+// BodyTooLargeError.
+func checkResponseWithLimit(r *http.Response, maxBodySize int64) error {
 	if c := r.StatusCode; c >= 200 && c <= 299 {
 		return nil
 	}
+	return newHTTPError(r, maxBodySize)
+}
 
+// newHTTPError reads the error body of the response into an HTTPError.
+func newHTTPError(r *http.Response, maxBodySize int64) error {
 	errorData := &HTTPError{
 		Response:   r,
 		StatusCode: r.StatusCode,
 		Err:        ErrHTTP,
 	}
-	data, err := ioutil.ReadAll(r.Body)
+	data, err := readLimited(r.Body, maxBodySize)
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		errorData.Err = errors.Join(ErrHTTP, tooLarge)
+		err = nil
+	}
 	if err == nil && data != nil {
 		errorData.Raw = data
 	}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type config struct {
+	Package string
+	Service string
+}
+
+type generator struct {
+	doc *document
+	cfg config
+	buf bytes.Buffer
+}
+
+// generate returns the formatted go source of the typed client.
+func generate(doc *document, cfg config) ([]byte, error) {
+	g := &generator{doc: doc, cfg: cfg}
+
+	ops, err := g.collectOperations()
+	if err != nil {
+		return nil, err
+	}
+
+	g.printf("// Code generated by jsonclient-gen. DO NOT EDIT.\n\n")
+	if doc.Info.Title != "" {
+		g.printf("// Package %s is the client of %s %s.\n", cfg.Package, doc.Info.Title, doc.Info.Version)
+	}
+	g.printf("package %s\n\n", cfg.Package)
+	g.printf("import (\n")
+	for _, imp := range g.imports(ops) {
+		g.printf("%q\n", imp)
+	}
+	g.printf("\n\"github.com/davidebianchi/go-jsonclient\"\n)\n\n")
+
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		g.genComponent(name, doc.Components.Schemas[name])
+	}
+
+	g.genService(ops)
+	for _, op := range ops {
+		g.genOperation(op)
+	}
+	g.genHelpers()
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code is not valid: %w", err)
+	}
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+type param struct {
+	name     string
+	goName   string
+	in       string
+	required bool
+	goType   string
+	isList   bool
+	comment  string
+}
+
+type errorResponse struct {
+	status string
+	goType string
+}
+
+type genOperation struct {
+	name        string
+	method      string
+	path        string
+	template    string
+	comment     string
+	deprecated  bool
+	params      []param
+	bodyType    string
+	resultType  string
+	errorBodies []errorResponse
+}
+
+func (o genOperation) hasParams() bool {
+	return len(o.params) > 0
+}
+
+func (g *generator) collectOperations() ([]genOperation, error) {
+	var ops []genOperation
+	for _, path := range sortedKeys(g.doc.Paths) {
+		item := g.doc.Paths[path]
+		for _, m := range item.operations() {
+			op, err := g.collectOperation(path, m.method, item, m.operation)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", m.method, path, err)
+			}
+			ops = append(ops, op)
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].name < ops[j].name })
+	return ops, nil
+}
+
+func (g *generator) collectOperation(path, method string, item *pathItem, o *operation) (genOperation, error) {
+	op := genOperation{
+		name:       o.OperationID,
+		method:     method,
+		path:       path,
+		comment:    firstNonEmpty(o.Summary, o.Description),
+		deprecated: o.Deprecated,
+	}
+	if op.name == "" {
+		op.name = strings.ToLower(method) + " " + path
+	}
+	op.name = goName(op.name)
+
+	params := map[string]*parameter{}
+	for _, p := range append(append([]*parameter{}, item.Parameters...), o.Parameters...) {
+		resolved, err := g.doc.resolveParameter(p)
+		if err != nil {
+			return op, err
+		}
+		params[resolved.In+":"+resolved.Name] = resolved
+	}
+	names := goNames{}
+	for _, key := range sortedKeys(params) {
+		p := params[key]
+		if p.In == "cookie" {
+			continue
+		}
+		required := p.Required || p.In == "path"
+		op.params = append(op.params, param{
+			name:     p.Name,
+			goName:   names.unique(p.Name),
+			in:       p.In,
+			required: required,
+			goType:   g.goType(p.Schema, required),
+			isList:   p.Schema != nil && p.Schema.Ref == "" && contains(p.Schema.Type, "array"),
+			comment:  p.Description,
+		})
+	}
+	op.template = pathTemplate(path)
+
+	if o.RequestBody != nil {
+		body, err := g.doc.resolveRequestBody(o.RequestBody)
+		if err != nil {
+			return op, err
+		}
+		if s := jsonSchema(body.Content); s != nil {
+			op.bodyType = g.goType(s, true)
+		}
+	}
+
+	for _, status := range sortedKeys(o.Responses) {
+		resp, err := g.doc.resolveResponse(o.Responses[status])
+		if err != nil {
+			return op, err
+		}
+		s := jsonSchema(resp.Content)
+		if strings.HasPrefix(status, "2") {
+			if op.resultType == "" && s != nil {
+				op.resultType = g.goType(s, true)
+			}
+			continue
+		}
+		if s != nil {
+			op.errorBodies = append(op.errorBodies, errorResponse{status: strings.ToUpper(status), goType: g.goType(s, true)})
+		}
+	}
+
+	return op, nil
+}
+
+func (g *generator) imports(ops []genOperation) []string {
+	imports := map[string]bool{
+		"context":  true,
+		"errors":   true,
+		"net/http": true,
+	}
+	for _, op := range ops {
+		for _, p := range op.params {
+			if p.in == "query" || p.in == "header" {
+				imports["fmt"] = true
+			}
+		}
+	}
+	for _, s := range g.doc.Components.Schemas {
+		if usesRawMessage(s) {
+			imports["encoding/json"] = true
+		}
+	}
+	for _, op := range ops {
+		for _, t := range []string{op.bodyType, op.resultType} {
+			if strings.Contains(t, "json.RawMessage") {
+				imports["encoding/json"] = true
+			}
+		}
+	}
+	return sortedKeys(imports)
+}
+
+func usesRawMessage(s *schema) bool {
+	if s == nil || s.Ref != "" {
+		return false
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		return true
+	}
+	for _, p := range s.Properties {
+		if usesRawMessage(p) {
+			return true
+		}
+	}
+	for _, sub := range s.AllOf {
+		if usesRawMessage(sub) {
+			return true
+		}
+	}
+	if s.AdditionalProperties != nil && usesRawMessage(s.AdditionalProperties.Schema) {
+		return true
+	}
+	return usesRawMessage(s.Items)
+}
+
+func (g *generator) genComponent(name string, s *schema) {
+	typeName := goName(name)
+	g.printf("// %s defines the %q schema.\n", typeName, name)
+	if s.Description != "" {
+		g.printf("//\n")
+		writeComment(&g.buf, s.Description)
+	}
+
+	typ, _ := s.Type.main()
+	if typ == "string" && len(s.Enum) > 0 {
+		g.printf("type %s string\n\n", typeName)
+		g.printf("// %s values\nconst (\n", typeName)
+		names := goNames{}
+		for _, v := range s.Enum {
+			value := fmt.Sprint(v)
+			g.printf("%s%s %s = %q\n", typeName, names.unique(value), typeName, value)
+		}
+		g.printf(")\n\n")
+		return
+	}
+	g.printf("type %s %s\n\n", typeName, g.goType(s, true))
+}
+
+// goType returns the go type of the schema. Not required scalar and struct
+// values are pointers, to distinguish zero values from missing values.
+func (g *generator) goType(s *schema, required bool) string {
+	if s == nil {
+		return "interface{}"
+	}
+	if s.Ref != "" {
+		return optional(goName(refName(s.Ref)), required && !s.Nullable)
+	}
+
+	typ, nullable := s.Type.main()
+	nullable = nullable || s.Nullable
+	if typ == "" {
+		switch {
+		case len(s.Properties) > 0 || len(s.AllOf) > 0:
+			typ = "object"
+		case s.Items != nil:
+			typ = "array"
+		}
+	}
+
+	switch {
+	case len(s.OneOf) > 0 || len(s.AnyOf) > 0:
+		return "json.RawMessage"
+	case typ == "string":
+		return optional("string", required && !nullable)
+	case typ == "integer":
+		if s.Format == "int32" {
+			return optional("int32", required && !nullable)
+		}
+		return optional("int64", required && !nullable)
+	case typ == "number":
+		if s.Format == "float" {
+			return optional("float32", required && !nullable)
+		}
+		return optional("float64", required && !nullable)
+	case typ == "boolean":
+		return optional("bool", required && !nullable)
+	case typ == "array":
+		return "[]" + g.goType(s.Items, true)
+	case typ == "object":
+		if len(s.Properties) == 0 && len(s.AllOf) == 0 {
+			if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+				return "map[string]" + g.goType(s.AdditionalProperties.Schema, true)
+			}
+			return "map[string]interface{}"
+		}
+		return optional(g.structType(s), required && !nullable)
+	}
+	return "interface{}"
+}
+
+func (g *generator) structType(s *schema) string {
+	var b bytes.Buffer
+	b.WriteString("struct {\n")
+	properties := map[string]*schema{}
+	required := map[string]bool{}
+	names := goNames{}
+	for _, sub := range s.AllOf {
+		if sub.Ref != "" {
+			embedded := goName(refName(sub.Ref))
+			names[embedded] = true
+			fmt.Fprintf(&b, "%s\n", embedded)
+			continue
+		}
+		for name, p := range sub.Properties {
+			properties[name] = p
+		}
+		for _, r := range sub.Required {
+			required[r] = true
+		}
+	}
+	for name, p := range s.Properties {
+		properties[name] = p
+	}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+
+	for _, name := range sortedKeys(properties) {
+		p := properties[name]
+		writeComment(&b, p.Description)
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", names.unique(name), g.goType(p, required[name]), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (g *generator) genService(ops []genOperation) {
+	service := g.cfg.Service
+	g.printf("// %s is the typed client of the API.\n", service)
+	g.printf("type %s struct {\nClient *jsonclient.Client\n}\n\n", service)
+	g.printf("// New%s creates the typed client using the passed json client.\n", service)
+	g.printf("func New%s(client *jsonclient.Client) *%s {\nreturn &%s{Client: client}\n}\n\n", service, service, service)
+
+	g.printf("// APIError is returned when the server responds with a not 2xx status code.\n")
+	g.printf("// Body contains the decoded error response, if the operation declares\n")
+	g.printf("// a json schema for the status code.\n")
+	g.printf("type APIError struct {\n*jsonclient.HTTPError\nBody interface{}\n}\n\n")
+	g.printf("func (e *APIError) Unwrap() error {\nreturn e.HTTPError\n}\n\n")
+}
+
+func (g *generator) genOperation(op genOperation) {
+	service := g.cfg.Service
+	paramsType := op.name + "Params"
+
+	if op.hasParams() {
+		g.printf("// %s contains the parameters of %s.\n", paramsType, op.name)
+		g.printf("type %s struct {\n", paramsType)
+		for _, p := range op.params {
+			writeComment(&g.buf, p.comment)
+			g.printf("%s %s\n", p.goName, p.goType)
+		}
+		g.printf("}\n\n")
+	}
+
+	// the summary follows the first line, since alone in its paragraph it
+	// could be a doc comment heading
+	g.printf("// %s calls %s %s.\n", op.name, op.method, op.path)
+	writeComment(&g.buf, op.comment)
+	if op.deprecated {
+		g.printf("//\n// Deprecated: the operation is deprecated.\n")
+	}
+
+	args := []string{"ctx context.Context"}
+	if op.hasParams() {
+		args = append(args, "params "+paramsType)
+	}
+	if op.bodyType != "" {
+		args = append(args, "body "+op.bodyType)
+	}
+	args = append(args, "opts ...jsonclient.RequestOption")
+
+	resultType := resultGoType(op.resultType)
+	returns := "(*http.Response, error)"
+	zero := ""
+	if op.resultType != "" {
+		returns = fmt.Sprintf("(%s, *http.Response, error)", resultType)
+		zero = "nil, "
+	}
+	g.printf("func (s *%s) %s(%s) %s {\n", service, op.name, strings.Join(args, ", "), returns)
+
+	vars := "nil"
+	var pathParams []param
+	for _, p := range op.params {
+		if p.in == "path" {
+			pathParams = append(pathParams, p)
+		}
+	}
+	if len(pathParams) > 0 {
+		var b strings.Builder
+		b.WriteString("jsonclient.TemplateVars{\n")
+		for _, p := range pathParams {
+			fmt.Fprintf(&b, "%q: params.%s,\n", templateVarName(p.name), p.goName)
+		}
+		b.WriteString("}")
+		vars = b.String()
+	}
+	body := "nil"
+	if op.bodyType != "" {
+		body = "body"
+	}
+	// the query and header params are request options, applied before the
+	// ones of the caller
+	reqOpts := "opts..."
+	hasParams := false
+	for _, p := range op.params {
+		if p.in == "query" || p.in == "header" {
+			hasParams = true
+		}
+	}
+	if hasParams {
+		g.printf("var reqOpts []jsonclient.RequestOption\n")
+		for _, p := range op.params {
+			switch p.in {
+			case "query":
+				g.genSetParam(p, fmt.Sprintf("reqOpts = append(reqOpts, jsonclient.WithAddedQuery(%q, fmt.Sprint(%%s)))", p.name))
+			case "header":
+				g.genSetParam(p, fmt.Sprintf("reqOpts = append(reqOpts, jsonclient.WithAddedHeader(%q, fmt.Sprint(%%s)))", p.name))
+			}
+		}
+		reqOpts = "append(reqOpts, opts...)..."
+	}
+	g.printf("req, err := s.Client.NewTemplateRequestWithContext(ctx, %s, %q, %s, %s, %s)\n", methodConstant(op.method), op.template, vars, body, reqOpts)
+	g.printf("if err != nil {\nreturn %snil, err\n}\n", zero)
+
+	target := "nil"
+	if op.resultType != "" {
+		if isReferenceType(op.resultType) {
+			g.printf("var out %s\n", op.resultType)
+			target = "&out"
+		} else {
+			g.printf("out := new(%s)\n", strings.TrimPrefix(op.resultType, "*"))
+			target = "out"
+		}
+	}
+	g.printf("resp, err := s.Client.Do(req, %s)\n", target)
+	g.printf("if err != nil {\n")
+	if len(op.errorBodies) > 0 {
+		g.printf("return %sresp, decodeAPIError(err, func(statusCode int) interface{} {\n", zero)
+		defaultType := ""
+		var cases []errorResponse
+		for _, e := range op.errorBodies {
+			if e.status == "DEFAULT" {
+				defaultType = e.goType
+				continue
+			}
+			cases = append(cases, e)
+		}
+		if len(cases) > 0 {
+			g.printf("switch {\n")
+			for _, e := range cases {
+				g.printf("case %s:\nreturn %s\n", statusCondition(e.status), newValue(e.goType))
+			}
+			g.printf("}\n")
+		}
+		if defaultType != "" {
+			g.printf("return %s\n})\n", newValue(defaultType))
+		} else {
+			g.printf("return nil\n})\n")
+		}
+	} else {
+		g.printf("return %sresp, decodeAPIError(err, nil)\n", zero)
+	}
+	g.printf("}\n")
+	if op.resultType != "" {
+		g.printf("return out, resp, nil\n}\n\n")
+	} else {
+		g.printf("return resp, nil\n}\n\n")
+	}
+}
+
+func (g *generator) genSetParam(p param, setter string) {
+	switch {
+	case p.isList:
+		g.printf("for _, v := range params.%s {\n%s\n}\n", p.goName, fmt.Sprintf(setter, "v"))
+	case strings.HasPrefix(p.goType, "*"):
+		g.printf("if params.%s != nil {\n%s\n}\n", p.goName, fmt.Sprintf(setter, "*params."+p.goName))
+	default:
+		g.printf("%s\n", fmt.Sprintf(setter, "params."+p.goName))
+	}
+}
+
+func (g *generator) genHelpers() {
+	g.printf(`// decodeAPIError converts an HTTPError to an APIError, decoding the error
+// response in the value returned by target.
+func decodeAPIError(err error, target func(statusCode int) interface{}) error {
+	var httpErr *jsonclient.HTTPError
+	if !errors.As(err, &httpErr) {
+		return err
+	}
+	apiErr := &APIError{HTTPError: httpErr}
+	if target == nil || len(httpErr.Raw) == 0 {
+		return apiErr
+	}
+	if body := target(httpErr.StatusCode); body != nil && httpErr.Unmarshal(body) == nil {
+		apiErr.Body = body
+	}
+	return apiErr
+}
+`)
+}
+
+func methodConstant(method string) string {
+	return "http.Method" + strings.ToUpper(method[:1]) + strings.ToLower(method[1:])
+}
+
+func statusCondition(status string) string {
+	if len(status) == 3 && strings.HasSuffix(status, "XX") {
+		class, _ := strconv.Atoi(status[:1])
+		return fmt.Sprintf("statusCode >= %d && statusCode < %d", class*100, class*100+100)
+	}
+	return "statusCode == " + status
+}
+
+func newValue(goType string) string {
+	return fmt.Sprintf("new(%s)", strings.TrimPrefix(goType, "*"))
+}
+
+func resultGoType(goType string) string {
+	if isReferenceType(goType) {
+		return goType
+	}
+	return "*" + strings.TrimPrefix(goType, "*")
+}
+
+func isReferenceType(goType string) bool {
+	return strings.HasPrefix(goType, "[]") || strings.HasPrefix(goType, "map[") || goType == "json.RawMessage" || goType == "interface{}"
+}
+
+func optional(goType string, required bool) string {
+	if required {
+		return goType
+	}
+	return "*" + goType
+}
+
+// pathTemplate converts the OpenAPI path to an URI template relative to the
+// client BaseURL.
+func pathTemplate(path string) string {
+	var b strings.Builder
+	rest := strings.TrimPrefix(path, "/")
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open == -1 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end == -1 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		b.WriteString(rest[:open])
+		fmt.Fprintf(&b, "{%s}", templateVarName(rest[open+1:open+end]))
+		rest = rest[open+end+1:]
+	}
+}
+
+// templateVarName returns a valid URI template variable name.
+func templateVarName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var initialisms = map[string]string{
+	"api":  "API",
+	"http": "HTTP",
+	"id":   "ID",
+	"ids":  "IDs",
+	"json": "JSON",
+	"uri":  "URI",
+	"url":  "URL",
+	"uuid": "UUID",
+}
+
+// goName converts a name to an exported go identifier.
+func goName(name string) string {
+	var words []string
+	for _, field := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words = append(words, splitCamelCase(field)...)
+	}
+
+	var b strings.Builder
+	for _, word := range words {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+
+	out := b.String()
+	if out == "" {
+		return "Empty"
+	}
+	if unicode.IsDigit(rune(out[0])) {
+		return "N" + out
+	}
+	return out
+}
+
+// goNames assigns unique go identifiers to the names of a scope, adding a
+// numeric suffix to the names converted to an identifier already assigned,
+// e.g. `pet_id` after `pet-id`.
+type goNames map[string]bool
+
+func (n goNames) unique(name string) string {
+	id := goName(name)
+	unique := id
+	for i := 2; n[unique]; i++ {
+		unique = id + strconv.Itoa(i)
+	}
+	n[unique] = true
+	return unique
+}
+
+// splitCamelCase splits a word on each lower to upper case transition.
+func splitCamelCase(word string) []string {
+	var words []string
+	runes := []rune(word)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+func writeComment(b *bytes.Buffer, comment string) {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(b, "// %s\n", strings.TrimRight(line, " "))
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
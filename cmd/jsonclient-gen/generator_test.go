@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	t.Run("generates the petstore client", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/petstore.yaml")
+		require.NoError(t, err)
+		doc, err := loadDocument(data)
+		require.NoError(t, err)
+
+		src, err := generate(doc, config{Package: "petstore", Service: "Service"})
+		require.NoError(t, err)
+
+		if *update {
+			require.NoError(t, os.WriteFile("testdata/petstore.golden", src, 0o644))
+		}
+		expected, err := os.ReadFile("testdata/petstore.golden")
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(src))
+	})
+
+	t.Run("golden output compiles", func(t *testing.T) {
+		golden, err := os.ReadFile("testdata/petstore.golden")
+		require.NoError(t, err)
+		require.NotContains(t, string(golden), "// #", "summaries must not become doc comment headings")
+		requireCompiles(t, golden)
+	})
+
+	t.Run("adds a suffix to the colliding names", func(t *testing.T) {
+		doc, err := loadDocument([]byte(`
+openapi: 3.0.3
+components:
+  schemas:
+    Kind:
+      type: string
+      enum: [a-b, a_b]
+    Item:
+      type: object
+      properties:
+        item-id: {type: string}
+        item_id: {type: string}
+paths:
+  /items:
+    get:
+      operationId: listItems
+      parameters:
+        - {name: pet-id, in: query, schema: {type: string}}
+        - {name: pet_id, in: query, schema: {type: string}}
+      responses:
+        "200": {description: ok}
+`))
+		require.NoError(t, err)
+
+		src, err := generate(doc, config{Package: "items", Service: "Service"})
+		require.NoError(t, err)
+		for _, name := range []string{"KindAB ", "KindAB2 ", "ItemID ", "ItemID2 ", "PetID ", "PetID2 "} {
+			require.Contains(t, string(src), name)
+		}
+		requireCompiles(t, src)
+	})
+
+	t.Run("output is stable", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/petstore.yaml")
+		require.NoError(t, err)
+
+		var outputs [][]byte
+		for i := 0; i < 5; i++ {
+			doc, err := loadDocument(data)
+			require.NoError(t, err)
+			src, err := generate(doc, config{Package: "petstore", Service: "Service"})
+			require.NoError(t, err)
+			outputs = append(outputs, src)
+		}
+		for _, out := range outputs[1:] {
+			require.Equal(t, outputs[0], out)
+		}
+	})
+
+	t.Run("accepts json documents", func(t *testing.T) {
+		doc, err := loadDocument([]byte(`{
+			"openapi": "3.0.3",
+			"info": {"title": "Users", "version": "2"},
+			"paths": {
+				"/users/{id}": {
+					"get": {
+						"operationId": "getUser",
+						"parameters": [{"name": "id", "in": "path", "schema": {"type": "integer"}}],
+						"responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"type": "object", "properties": {"name": {"type": "string", "nullable": true}}}}}}}
+					}
+				}
+			}
+		}`))
+		require.NoError(t, err)
+
+		src, err := generate(doc, config{Package: "users", Service: "Users"})
+		require.NoError(t, err)
+		require.Contains(t, string(src), "func (s *Users) GetUser(ctx context.Context, params GetUserParams, opts ...jsonclient.RequestOption) (*struct {")
+		require.Contains(t, string(src), "Name *string `json:\"name,omitempty\"`")
+		require.Contains(t, string(src), `s.Client.NewTemplateRequestWithContext(ctx, http.MethodGet, "users/{id}", jsonclient.TemplateVars{`)
+	})
+
+	t.Run("throws with unresolvable references", func(t *testing.T) {
+		doc, err := loadDocument([]byte(`
+openapi: 3.0.0
+paths:
+  /a:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/Missing'
+`))
+		require.NoError(t, err)
+
+		_, err = generate(doc, config{Package: "a", Service: "Service"})
+		require.EqualError(t, err, `GET /a: unresolvable parameter "#/components/parameters/Missing"`)
+	})
+}
+
+func TestLoadDocument(t *testing.T) {
+	t.Run("throws with unsupported version", func(t *testing.T) {
+		_, err := loadDocument([]byte(`swagger: "2.0"`))
+		require.EqualError(t, err, `unsupported openapi version ""`)
+	})
+
+	t.Run("throws with invalid document", func(t *testing.T) {
+		_, err := loadDocument([]byte(`openapi: [`))
+		require.Error(t, err)
+	})
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"showPetById":   "ShowPetByID",
+		"pet-id":        "PetID",
+		"X-Request-ID":  "XRequestID",
+		"get /users":    "GetUsers",
+		"user_name":     "UserName",
+		"201":           "N201",
+		"":              "Empty",
+		"api_url":       "APIURL",
+		"HTTPResponse":  "HTTPResponse",
+		"already.Named": "AlreadyNamed",
+	}
+	for name, expected := range tests {
+		require.Equal(t, expected, goName(name), name)
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	require.Equal(t, "pets/{pet_id}/toys/{toy}", pathTemplate("/pets/{pet-id}/toys/{toy}"))
+	require.Equal(t, "pets", pathTemplate("/pets"))
+}
+
+func TestRun(t *testing.T) {
+	t.Run("writes to stdout", func(t *testing.T) {
+		var out bytes.Buffer
+		err := run([]string{"-spec", "testdata/petstore.yaml", "-package", "petstore"}, &out)
+		require.NoError(t, err)
+
+		expected, err := os.ReadFile("testdata/petstore.golden")
+		require.NoError(t, err)
+		require.Equal(t, string(expected), out.String())
+	})
+
+	t.Run("writes to file", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "client.go")
+		err := run([]string{"-spec", "testdata/petstore.yaml", "-package", "petstore", "-out", outPath}, &bytes.Buffer{})
+		require.NoError(t, err)
+
+		_, err = os.Stat(outPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("throws without spec", func(t *testing.T) {
+		err := run([]string{}, &bytes.Buffer{})
+		require.EqualError(t, err, "-spec is required")
+	})
+}
+
+// requireCompiles builds the generated source in a module requiring the
+// jsonclient module of the repository.
+func requireCompiles(t *testing.T, src []byte) {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available")
+	}
+	root, err := filepath.Abs("../..")
+	require.NoError(t, err)
+	sum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	goMod := "module generated\n\ngo 1.20\n\n" +
+		"require github.com/davidebianchi/go-jsonclient v0.0.0\n\n" +
+		"replace github.com/davidebianchi/go-jsonclient => " + root + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client.go"), src, 0o644))
+
+	cmd := exec.Command(goBin, "vet", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off", "GOPROXY=off")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
@@ -0,0 +1,54 @@
+// Command jsonclient-gen generates a typed Go client, built on top of
+// jsonclient, from an OpenAPI 3.0/3.1 document (in JSON or YAML format).
+//
+// Usage:
+//
+//	jsonclient-gen -spec openapi.yaml -package petstore -out client.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "jsonclient-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("jsonclient-gen", flag.ContinueOnError)
+	spec := flags.String("spec", "", "path of the OpenAPI document (required)")
+	out := flags.String("out", "", "path of the generated file (default stdout)")
+	pkg := flags.String("package", "client", "package name of the generated file")
+	service := flags.String("service", "Service", "name of the generated service struct")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *spec == "" {
+		return fmt.Errorf("-spec is required")
+	}
+
+	data, err := os.ReadFile(*spec)
+	if err != nil {
+		return err
+	}
+	doc, err := loadDocument(data)
+	if err != nil {
+		return err
+	}
+	src, err := generate(doc, config{Package: *pkg, Service: *service})
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0o644)
+}
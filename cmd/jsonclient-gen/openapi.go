@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// document is the subset of an OpenAPI 3.0/3.1 document used by the generator.
+type document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       info                 `json:"info"`
+	Paths      map[string]*pathItem `json:"paths"`
+	Components components           `json:"components"`
+}
+
+type info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type components struct {
+	Schemas       map[string]*schema      `json:"schemas"`
+	Parameters    map[string]*parameter   `json:"parameters"`
+	RequestBodies map[string]*requestBody `json:"requestBodies"`
+	Responses     map[string]*response    `json:"responses"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `json:"parameters"`
+	Get        *operation   `json:"get"`
+	Put        *operation   `json:"put"`
+	Post       *operation   `json:"post"`
+	Delete     *operation   `json:"delete"`
+	Options    *operation   `json:"options"`
+	Head       *operation   `json:"head"`
+	Patch      *operation   `json:"patch"`
+	Trace      *operation   `json:"trace"`
+}
+
+// operations returns the operations of the path item, in a stable order.
+func (p *pathItem) operations() []methodOperation {
+	var ops []methodOperation
+	for _, m := range []methodOperation{
+		{"GET", p.Get},
+		{"PUT", p.Put},
+		{"POST", p.Post},
+		{"DELETE", p.Delete},
+		{"OPTIONS", p.Options},
+		{"HEAD", p.Head},
+		{"PATCH", p.Patch},
+		{"TRACE", p.Trace},
+	} {
+		if m.operation != nil {
+			ops = append(ops, m)
+		}
+	}
+	return ops
+}
+
+type methodOperation struct {
+	method    string
+	operation *operation
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Description string               `json:"description"`
+	Deprecated  bool                 `json:"deprecated"`
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *requestBody         `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Required    bool                  `json:"required"`
+	Content     map[string]*mediaType `json:"content"`
+}
+
+type response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 schemaType         `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schemaOrBool      `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	Nullable             bool               `json:"nullable"`
+	AllOf                []*schema          `json:"allOf"`
+	OneOf                []*schema          `json:"oneOf"`
+	AnyOf                []*schema          `json:"anyOf"`
+}
+
+// schemaType handles both the OpenAPI 3.0 string type and the OpenAPI 3.1
+// array of types.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// main returns the type ignoring null, and if null is one of the types.
+func (t schemaType) main() (string, bool) {
+	var main string
+	nullable := false
+	for _, typ := range t {
+		if typ == "null" {
+			nullable = true
+			continue
+		}
+		if main == "" {
+			main = typ
+		}
+	}
+	return main, nullable
+}
+
+type schemaOrBool struct {
+	Allowed bool
+	Schema  *schema
+}
+
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Allowed); err == nil {
+		return nil
+	}
+	s.Allowed = true
+	return json.Unmarshal(data, &s.Schema)
+}
+
+// loadDocument parses an OpenAPI document, in JSON or YAML format.
+func loadDocument(data []byte) (*document, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	normalized, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+
+	doc := &document{}
+	if err := json.Unmarshal(normalized, doc); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q", doc.OpenAPI)
+	}
+	return doc, nil
+}
+
+// normalizeYAML converts the maps with not string keys (e.g. status codes)
+// to be marshaled in json.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func (d *document) resolveParameter(p *parameter) (*parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	resolved, ok := d.Components.Parameters[refName(p.Ref)]
+	if !ok {
+		return nil, fmt.Errorf("unresolvable parameter %q", p.Ref)
+	}
+	return resolved, nil
+}
+
+func (d *document) resolveRequestBody(b *requestBody) (*requestBody, error) {
+	if b.Ref == "" {
+		return b, nil
+	}
+	resolved, ok := d.Components.RequestBodies[refName(b.Ref)]
+	if !ok {
+		return nil, fmt.Errorf("unresolvable request body %q", b.Ref)
+	}
+	return resolved, nil
+}
+
+func (d *document) resolveResponse(r *response) (*response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	resolved, ok := d.Components.Responses[refName(r.Ref)]
+	if !ok {
+		return nil, fmt.Errorf("unresolvable response %q", r.Ref)
+	}
+	return resolved, nil
+}
+
+// jsonSchema returns the schema of the json media type, if any.
+func jsonSchema(content map[string]*mediaType) *schema {
+	for _, contentType := range sortedKeys(content) {
+		if isJSONContentType(contentType) && content[contentType] != nil {
+			return content[contentType].Schema
+		}
+	}
+	return nil
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidebianchi/go-jsonclient"
+)
+
+// Environment variables read by the command
+const (
+	envBaseURL = "JSONCLIENT_BASE_URL"
+	envHost    = "JSONCLIENT_HOST"
+	envHeaders = "JSONCLIENT_HEADERS"
+	envProfile = "JSONCLIENT_PROFILE"
+	envConfig  = "JSONCLIENT_CONFIG"
+)
+
+// profile contains the client options, as saved in the profile file.
+type profile struct {
+	BaseURL string             `json:"baseURL"`
+	Headers jsonclient.Headers `json:"headers"`
+	Host    string             `json:"host"`
+}
+
+// profileFile is the format of the profile file, e.g.
+//
+//	{"profiles": {"dev": {"baseURL": "http://localhost:8080/api/", "headers": {"Authorization": "Bearer token"}}}}
+type profileFile struct {
+	Profiles map[string]profile `json:"profiles"`
+}
+
+func defaultConfigPath(getenv func(string) string) string {
+	if path := getenv(envConfig); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "jsonclient", "profiles.json")
+}
+
+func loadProfile(path, name string) (profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return profile{}, fmt.Errorf("reading profile file: %w", err)
+	}
+	var file profileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return profile{}, fmt.Errorf("invalid profile file %s: %w", path, err)
+	}
+	p, ok := file.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	return p, nil
+}
+
+// resolveOptions merges, in order of precedence, flags, environment variables
+// and the profile.
+func resolveOptions(f *cliFlags, getenv func(string) string) (jsonclient.Options, error) {
+	var p profile
+
+	profileName := f.profile
+	if profileName == "" {
+		profileName = getenv(envProfile)
+	}
+	if profileName != "" {
+		configPath := f.config
+		if configPath == "" {
+			configPath = defaultConfigPath(getenv)
+		}
+		var err error
+		p, err = loadProfile(configPath, profileName)
+		if err != nil {
+			return jsonclient.Options{}, err
+		}
+	}
+
+	headers := jsonclient.Headers{}
+	mergeHeaders(headers, p.Headers)
+	if env := getenv(envHeaders); env != "" {
+		fromEnv, err := parseHeaderList(strings.Split(env, "\n"))
+		if err != nil {
+			return jsonclient.Options{}, fmt.Errorf("invalid %s: %w", envHeaders, err)
+		}
+		mergeHeaders(headers, fromEnv)
+	}
+	flagHeaders, err := parseHeaderList(f.headers)
+	if err != nil {
+		return jsonclient.Options{}, err
+	}
+	mergeHeaders(headers, flagHeaders)
+
+	return jsonclient.Options{
+		BaseURL: firstNonEmpty(f.baseURL, getenv(envBaseURL), p.BaseURL),
+		Host:    firstNonEmpty(f.host, getenv(envHost), p.Host),
+		Headers: headers,
+	}, nil
+}
+
+// mergeHeaders sets the headers of src in dst with their canonical name, so
+// that they override the ones with the same name in a different case.
+func mergeHeaders(dst, src jsonclient.Headers) {
+	for k, v := range src {
+		dst[http.CanonicalHeaderKey(k)] = v
+	}
+}
+
+// parseHeaderList parses headers in the `Name: value` form, with their
+// canonical name.
+func parseHeaderList(list []string) (jsonclient.Headers, error) {
+	headers := jsonclient.Headers{}
+	for _, h := range list {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
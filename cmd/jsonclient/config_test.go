@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidebianchi/go-jsonclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveOptions(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "profiles.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{
+		"profiles": {
+			"dev": {
+				"baseURL": "http://dev:8080/api/",
+				"host": "dev-host",
+				"headers": {"Authorization": "Bearer dev", "X-Profile": "dev"}
+			}
+		}
+	}`), 0o600))
+
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("reads options from profile", func(t *testing.T) {
+		opts, err := resolveOptions(&cliFlags{profile: "dev", config: configPath}, env(nil))
+		require.NoError(t, err)
+		require.Equal(t, jsonclient.Options{
+			BaseURL: "http://dev:8080/api/",
+			Host:    "dev-host",
+			Headers: jsonclient.Headers{"Authorization": "Bearer dev", "X-Profile": "dev"},
+		}, opts)
+	})
+
+	t.Run("flags take precedence over env and env over profile", func(t *testing.T) {
+		opts, err := resolveOptions(&cliFlags{
+			baseURL: "http://flag/",
+			headers: headerFlags{"Authorization: Bearer flag"},
+		}, env(map[string]string{
+			envProfile: "dev",
+			envConfig:  configPath,
+			envHost:    "env-host",
+			envHeaders: "X-Profile: env",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, jsonclient.Options{
+			BaseURL: "http://flag/",
+			Host:    "env-host",
+			Headers: jsonclient.Headers{"Authorization": "Bearer flag", "X-Profile": "env"},
+		}, opts)
+	})
+
+	t.Run("overrides headers regardless of their case", func(t *testing.T) {
+		opts, err := resolveOptions(&cliFlags{
+			profile: "dev",
+			config:  configPath,
+			headers: headerFlags{"authorization: Bearer flag"},
+		}, env(map[string]string{
+			envHeaders: "x-profile: env\nX-PROFILE: env-upper",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, jsonclient.Headers{"Authorization": "Bearer flag", "X-Profile": "env-upper"}, opts.Headers)
+	})
+
+	t.Run("throws with unknown profile", func(t *testing.T) {
+		_, err := resolveOptions(&cliFlags{profile: "prod", config: configPath}, env(nil))
+		require.EqualError(t, err, `profile "prod" not found in `+configPath)
+	})
+
+	t.Run("throws with invalid headers", func(t *testing.T) {
+		_, err := resolveOptions(&cliFlags{headers: headerFlags{"no-colon"}}, env(nil))
+		require.EqualError(t, err, `invalid header "no-colon", expected "Name: value"`)
+
+		_, err = resolveOptions(&cliFlags{}, env(map[string]string{envHeaders: ": value"}))
+		require.EqualError(t, err, `invalid JSONCLIENT_HEADERS: invalid header ": value", expected "Name: value"`)
+	})
+}
@@ -0,0 +1,204 @@
+// Command jsonclient performs http requests with json bodies, using the same
+// client options of the jsonclient library.
+//
+// Usage:
+//
+//	jsonclient [flags] METHOD PATH
+//
+// Client options are read, in order of precedence, from flags, environment
+// variables (JSONCLIENT_BASE_URL, JSONCLIENT_HOST, JSONCLIENT_HEADERS with one
+// `Name: value` header per line) and a profile of the profile file
+// (selected with -profile or JSONCLIENT_PROFILE).
+//
+// The request body could be passed inline (-d '{"a":1}'), from a file
+// (-d @body.json) or from stdin (-d @-).
+// If the response status code is not 2xx, the error is printed on stderr and
+// the command exits with status 1.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/davidebianchi/go-jsonclient"
+)
+
+type cliFlags struct {
+	baseURL string
+	host    string
+	headers headerFlags
+	profile string
+	config  string
+	data    string
+	color   string
+	raw     bool
+	include bool
+}
+
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr, isTerminal(os.Stdout)))
+}
+
+func run(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer, tty bool) int {
+	f := &cliFlags{}
+	flags := flag.NewFlagSet("jsonclient", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&f.baseURL, "base-url", "", "base url of the requests (env "+envBaseURL+")")
+	flags.StringVar(&f.host, "host", "", "host header of the requests (env "+envHost+")")
+	flags.Var(&f.headers, "H", "header in the `Name: value` form, could be repeated")
+	flags.StringVar(&f.profile, "profile", "", "profile of the profile file (env "+envProfile+")")
+	flags.StringVar(&f.config, "config", "", "path of the profile file (env "+envConfig+")")
+	flags.StringVar(&f.data, "d", "", "json request body, @file to read it from file or @- from stdin")
+	flags.StringVar(&f.color, "color", "auto", "colorize output: auto, always or never")
+	flags.BoolVar(&f.raw, "raw", false, "print the response body as is, without pretty print")
+	flags.BoolVar(&f.include, "i", false, "print the response status and headers")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: jsonclient [flags] METHOD PATH\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	color, err := useColor(f.color, getenv, tty)
+	if err != nil {
+		fmt.Fprintf(stderr, "jsonclient: %s\n", err)
+		return 2
+	}
+
+	if err := execute(f, flags.Arg(0), flags.Arg(1), getenv, stdin, stdout, color); err != nil {
+		var httpErr *jsonclient.HTTPError
+		if errors.As(err, &httpErr) {
+			fmt.Fprintf(stderr, "%s %s: %s\n",
+				httpErr.Response.Request.Method,
+				httpErr.Response.Request.URL,
+				httpErr.Response.Status,
+			)
+			stderr.Write(format(httpErr.Raw, f.raw, color))
+			return 1
+		}
+		fmt.Fprintf(stderr, "jsonclient: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func execute(f *cliFlags, method, path string, getenv func(string) string, stdin io.Reader, stdout io.Writer, color bool) error {
+	opts, err := resolveOptions(f, getenv)
+	if err != nil {
+		return err
+	}
+	client, err := jsonclient.New(opts)
+	if err != nil {
+		return err
+	}
+
+	body, err := readBody(f.data, stdin)
+	if err != nil {
+		return err
+	}
+
+	req, err := client.NewRequestWithContext(context.Background(), strings.ToUpper(method), path, body)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	resp, err := client.Do(req, &buf)
+	if err != nil {
+		return err
+	}
+
+	if f.include {
+		fmt.Fprintf(stdout, "%s %s\n", resp.Proto, resp.Status)
+		names := make([]string, 0, len(resp.Header))
+		for name := range resp.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range resp.Header[name] {
+				fmt.Fprintf(stdout, "%s: %s\n", name, value)
+			}
+		}
+		fmt.Fprintln(stdout)
+	}
+	_, err = stdout.Write(format(buf.Bytes(), f.raw, color))
+	return err
+}
+
+// readBody returns the request body as json.RawMessage, to be sent as is.
+func readBody(data string, stdin io.Reader) (interface{}, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	raw := []byte(data)
+	if strings.HasPrefix(data, "@") {
+		var err error
+		if data == "@-" {
+			raw, err = io.ReadAll(stdin)
+		} else {
+			raw, err = os.ReadFile(strings.TrimPrefix(data, "@"))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading body: %w", err)
+		}
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("request body is not a valid json")
+	}
+	return json.RawMessage(raw), nil
+}
+
+func format(body []byte, raw, color bool) []byte {
+	if raw {
+		return body
+	}
+	return prettyJSON(body, color)
+}
+
+func useColor(mode string, getenv func(string) string, tty bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return tty && getenv("NO_COLOR") == "", nil
+	}
+	return false, fmt.Errorf("invalid -color value %q", mode)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var lastRequest *http.Request
+	var lastBody string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lastRequest = req
+		body, _ := ioutil.ReadAll(req.Body)
+		lastBody = string(body)
+		if req.URL.Path == "/api/missing" {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","tags":["a"]}`))
+	}))
+	defer s.Close()
+
+	noEnv := func(string) string { return "" }
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("performs request and pretty prints response", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-base-url", s.URL + "/api", "-H", "X-Custom: value", "get", "resource"}, noEnv, nil, &stdout, &stderr, false)
+
+		require.Equal(t, 0, code, stderr.String())
+		require.Equal(t, "{\n  \"id\": \"1\",\n  \"tags\": [\n    \"a\"\n  ]\n}\n", stdout.String())
+		require.Equal(t, http.MethodGet, lastRequest.Method)
+		require.Equal(t, "/api/resource", lastRequest.URL.Path)
+		require.Equal(t, "value", lastRequest.Header.Get("X-Custom"))
+	})
+
+	t.Run("prints raw response", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-base-url", s.URL, "-raw", "GET", "resource"}, noEnv, nil, &stdout, &stderr, true)
+
+		require.Equal(t, 0, code)
+		require.Equal(t, `{"id":"1","tags":["a"]}`, stdout.String())
+	})
+
+	t.Run("colorize response", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-base-url", s.URL, "GET", "resource"}, noEnv, nil, &stdout, &stderr, true)
+
+		require.Equal(t, 0, code)
+		require.Contains(t, stdout.String(), colorKey+`"id"`+colorReset)
+	})
+
+	t.Run("sends body from flag, file and stdin", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-base-url", s.URL, "-d", `{"name": "a"}`, "POST", "resource"}, noEnv, nil, &stdout, &stderr, false)
+		require.Equal(t, 0, code, stderr.String())
+		require.Equal(t, "{\"name\":\"a\"}\n", lastBody)
+		require.Equal(t, "application/json", lastRequest.Header.Get("Content-Type"))
+
+		bodyPath := filepath.Join(t.TempDir(), "body.json")
+		require.NoError(t, os.WriteFile(bodyPath, []byte(`{"from": "file"}`), 0o600))
+		code = run([]string{"-base-url", s.URL, "-d", "@" + bodyPath, "PUT", "resource"}, noEnv, nil, &stdout, &stderr, false)
+		require.Equal(t, 0, code, stderr.String())
+		require.Equal(t, "{\"from\":\"file\"}\n", lastBody)
+
+		code = run([]string{"-base-url", s.URL, "-d", "@-", "PATCH", "resource"}, noEnv, strings.NewReader(`[1, 2]`), &stdout, &stderr, false)
+		require.Equal(t, 0, code, stderr.String())
+		require.Equal(t, "[1,2]\n", lastBody)
+	})
+
+	t.Run("throws with not json body", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-base-url", s.URL, "-d", `{not json`, "POST", "resource"}, noEnv, nil, &stdout, &stderr, false)
+
+		require.Equal(t, 1, code)
+		require.Equal(t, "jsonclient: request body is not a valid json\n", stderr.String())
+	})
+
+	t.Run("exits with error on not 2xx response", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-base-url", s.URL + "/api/", "GET", "missing"}, noEnv, nil, &stdout, &stderr, false)
+
+		require.Equal(t, 1, code)
+		require.Empty(t, stdout.String())
+		require.Equal(t, "GET "+s.URL+"/api/missing: 404 Not Found\n{\n  \"message\": \"Not Found\"\n}\n", stderr.String())
+	})
+
+	t.Run("reads options from env", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-i", "GET", "resource"}, env(map[string]string{
+			envBaseURL: s.URL + "/api",
+			envHost:    "my-host",
+			envHeaders: "X-One: 1\nX-Two: 2",
+		}), nil, &stdout, &stderr, false)
+
+		require.Equal(t, 0, code, stderr.String())
+		require.Equal(t, "my-host", lastRequest.Host)
+		require.Equal(t, "1", lastRequest.Header.Get("X-One"))
+		require.Equal(t, "2", lastRequest.Header.Get("X-Two"))
+		require.True(t, strings.HasPrefix(stdout.String(), "HTTP/1.1 200 OK\nContent-Length: 23\nContent-Type: application/json\n"))
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		require.Equal(t, 2, run([]string{"GET"}, noEnv, nil, &stdout, &stderr, false))
+		require.Contains(t, stderr.String(), "Usage: jsonclient [flags] METHOD PATH")
+
+		require.Equal(t, 2, run([]string{"-color", "sometimes", "GET", "a"}, noEnv, nil, &stdout, &stderr, false))
+		require.Equal(t, 2, run([]string{"-unknown", "GET", "a"}, noEnv, nil, &stdout, &stderr, false))
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ANSI colors used to colorize json
+const (
+	colorReset   = "\x1b[0m"
+	colorKey     = "\x1b[34;1m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[36m"
+	colorLiteral = "\x1b[35m"
+)
+
+// prettyJSON indents the json document and, if color is true, colorizes it.
+// Not json documents are returned as is.
+func prettyJSON(data []byte, color bool) []byte {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return data
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, trimmed, "", "  "); err != nil {
+		return data
+	}
+	out.WriteByte('\n')
+	if !color {
+		return out.Bytes()
+	}
+	return colorizeJSON(out.Bytes())
+}
+
+// colorizeJSON adds ANSI colors to a valid json document.
+func colorizeJSON(data []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			end := stringEnd(data, i)
+			color := colorString
+			if isKey(data, end) {
+				color = colorKey
+			}
+			out.WriteString(color)
+			out.Write(data[i:end])
+			out.WriteString(colorReset)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i
+			for end < len(data) && bytes.IndexByte([]byte("+-.0123456789eE"), data[end]) != -1 {
+				end++
+			}
+			out.WriteString(colorNumber)
+			out.Write(data[i:end])
+			out.WriteString(colorReset)
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i
+			for end < len(data) && data[end] >= 'a' && data[end] <= 'z' {
+				end++
+			}
+			out.WriteString(colorLiteral)
+			out.Write(data[i:end])
+			out.WriteString(colorReset)
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
+
+// stringEnd returns the index after the closing quote of the string starting at i.
+func stringEnd(data []byte, i int) int {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(data)
+}
+
+func isKey(data []byte, i int) bool {
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ':':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrettyJSON(t *testing.T) {
+	t.Run("indents json", func(t *testing.T) {
+		require.Equal(t, "{\n  \"a\": [\n    1\n  ]\n}\n", string(prettyJSON([]byte(`{"a":[1]}`), false)))
+	})
+
+	t.Run("returns not json as is", func(t *testing.T) {
+		require.Equal(t, "plain text", string(prettyJSON([]byte("plain text"), true)))
+		require.Equal(t, "", string(prettyJSON(nil, true)))
+	})
+
+	t.Run("colorizes keys and values", func(t *testing.T) {
+		out := string(prettyJSON([]byte(`{"k\"ey":"v:al","n":-1.5e3,"b":true,"z":null}`), true))
+		require.Equal(t, "{\n  "+
+			colorKey+`"k\"ey"`+colorReset+": "+colorString+`"v:al"`+colorReset+",\n  "+
+			colorKey+`"n"`+colorReset+": "+colorNumber+"-1.5e3"+colorReset+",\n  "+
+			colorKey+`"b"`+colorReset+": "+colorLiteral+"true"+colorReset+",\n  "+
+			colorKey+`"z"`+colorReset+": "+colorLiteral+"null"+colorReset+"\n}\n", out)
+	})
+}
@@ -0,0 +1,170 @@
+package jsonclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// coalescedHeaders are the headers always part of the coalescing key, so that
+// requests of different credentials, representations, ranges or conditions
+// are never shared.
+var coalescedHeaders = []string{
+	"Accept",
+	"Accept-Encoding",
+	"Accept-Language",
+	"Authorization",
+	"Cookie",
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+	"Range",
+}
+
+// CoalescingPolicy struct define how identical in-flight requests are
+// coalesced: concurrent GET and HEAD requests without body, with the same
+// method, url and headers, share a single request to the server. Each caller
+// receives its own copy of the response, and decodes it independently.
+type CoalescingPolicy struct {
+	// Headers are the request headers part of the coalescing key, in
+	// addition to the Accept, Accept-Encoding, Accept-Language,
+	// Authorization, Cookie, Range and conditional ones.
+	Headers []string
+}
+
+type coalescer struct {
+	headers []string
+
+	mtx   sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is a request shared by its waiters. It is cancelled when all
+// the waiters have gone.
+type coalescedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+func newCoalescer(policy CoalescingPolicy) *coalescer {
+	headers := append([]string(nil), coalescedHeaders...)
+	for _, header := range policy.Headers {
+		headers = append(headers, http.CanonicalHeaderKey(header))
+	}
+	return &coalescer{headers: headers, calls: map[string]*coalescedCall{}}
+}
+
+func (c *coalescer) key(req *http.Request) string {
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.URL.String() + "\nHost: " + req.Host)
+	for _, header := range c.headers {
+		key.WriteString("\n" + header + ": " + strings.Join(req.Header.Values(header), ", "))
+	}
+	return key.String()
+}
+
+// do sends the request with send, unless an identical request is in flight,
+// whose response is shared. The response body is read in memory, up to the
+// limit if positive.
+func (c *coalescer) do(req *http.Request, limit int64, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	key := c.key(req)
+
+	c.mtx.Lock()
+	call, ok := c.calls[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(detachedContext{req.Context()})
+		call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = call
+		go c.run(key, call, req.WithContext(ctx), limit, send)
+	}
+	call.waiters++
+	c.mtx.Unlock()
+
+	select {
+	case <-call.done:
+	case <-req.Context().Done():
+		c.mtx.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			if c.calls[key] == call {
+				delete(c.calls, key)
+			}
+		}
+		c.mtx.Unlock()
+		return nil, req.Context().Err()
+	}
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	resp := *call.resp
+	resp.Header = call.resp.Header.Clone()
+	resp.Trailer = call.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(call.body))
+	resp.Request = req
+	return &resp, nil
+}
+
+func (c *coalescer) run(key string, call *coalescedCall, req *http.Request, limit int64, send func(*http.Request) (*http.Response, error)) {
+	defer call.cancel()
+	resp, err := send(req)
+	if err == nil {
+		var body io.Reader = resp.Body
+		if limit > 0 {
+			body = io.LimitReader(resp.Body, limit)
+		}
+		call.body, err = io.ReadAll(body)
+		drainAndClose(resp.Body)
+		resp.Body = http.NoBody
+	}
+	call.resp, call.err = resp, err
+
+	c.mtx.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	c.mtx.Unlock()
+	close(call.done)
+}
+
+// detachedContext keeps the values of the parent context, but not its
+// cancellation, so that a shared request outlives the waiter which sent it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// coalescingLimit returns the size of the shared response bodies read in
+// memory: one byte more than the largest body size limit, so that larger
+// bodies are still detected, or zero if any of the limits is not set.
+func (c *Client) coalescingLimit() int64 {
+	limit := c.maxBodySize
+	for _, size := range []int64{c.maxErrorBodySize, c.maxWriterSize} {
+		if limit == 0 || size == 0 {
+			return 0
+		}
+		if size > limit {
+			limit = size
+		}
+	}
+	return limit + 1
+}
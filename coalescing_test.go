@@ -0,0 +1,177 @@
+package jsonclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescing(t *testing.T) {
+	var calls, cancelled int64
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		select {
+		case <-release:
+		case <-req.Context().Done():
+			atomic.AddInt64(&cancelled, 1)
+			return
+		}
+		if req.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not found"}`))
+			return
+		}
+		w.Write([]byte(`{"tenant": "` + req.Header.Get("X-Tenant") + `"}`))
+	}))
+	defer s.Close()
+
+	reset := func() {
+		atomic.StoreInt64(&calls, 0)
+		atomic.StoreInt64(&cancelled, 0)
+		release = make(chan struct{})
+	}
+	waiters := func(client *Client) int {
+		client.coalescer.mtx.Lock()
+		defer client.coalescer.mtx.Unlock()
+		count := 0
+		for _, call := range client.coalescer.calls {
+			count += call.waiters
+		}
+		return count
+	}
+	type result struct {
+		v   map[string]string
+		err error
+	}
+	doAll := func(t *testing.T, client *Client, reqs []*http.Request) []result {
+		t.Helper()
+		results := make([]result, len(reqs))
+		var wg sync.WaitGroup
+		for i, req := range reqs {
+			wg.Add(1)
+			go func(i int, req *http.Request) {
+				defer wg.Done()
+				_, results[i].err = client.Do(req, &results[i].v)
+			}(i, req)
+		}
+		require.Eventually(t, func() bool { return waiters(client) == len(reqs) }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+		return results
+	}
+
+	client, err := New(Options{BaseURL: s.URL, Coalescing: &CoalescingPolicy{Headers: []string{"x-tenant"}}})
+	require.NoError(t, err)
+	newRequest := func(t *testing.T, ctx context.Context, path string, header http.Header) *http.Request {
+		t.Helper()
+		req, err := client.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		require.NoError(t, err)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		return req
+	}
+
+	t.Run("shares a single request", func(t *testing.T) {
+		reset()
+		var reqs []*http.Request
+		for i := 0; i < 10; i++ {
+			reqs = append(reqs, newRequest(t, context.Background(), "resource", http.Header{"X-Tenant": {"a"}, "X-Other": {string(rune('a' + i))}}))
+		}
+		results := doAll(t, client, reqs)
+		require.EqualValues(t, 1, atomic.LoadInt64(&calls))
+		for _, result := range results {
+			require.NoError(t, result.err)
+			require.Equal(t, map[string]string{"tenant": "a"}, result.v)
+		}
+		results[0].v["tenant"] = "changed"
+		require.Equal(t, "a", results[1].v["tenant"])
+	})
+
+	t.Run("keys by method, url and selected headers", func(t *testing.T) {
+		reset()
+		results := doAll(t, client, []*http.Request{
+			newRequest(t, context.Background(), "resource", http.Header{"X-Tenant": {"a"}}),
+			newRequest(t, context.Background(), "resource", http.Header{"X-Tenant": {"b"}}),
+			newRequest(t, context.Background(), "resource", http.Header{"X-Tenant": {"a"}, "Authorization": {"Bearer token"}}),
+			newRequest(t, context.Background(), "resource?page=2", http.Header{"X-Tenant": {"a"}}),
+		})
+		require.EqualValues(t, 4, atomic.LoadInt64(&calls))
+		require.Equal(t, "b", results[1].v["tenant"])
+
+		reset()
+		doAll(t, client, []*http.Request{
+			newRequest(t, context.Background(), "resource", http.Header{"Range": {"bytes=0-9"}}),
+			newRequest(t, context.Background(), "resource", http.Header{"Range": {"bytes=10-19"}}),
+			newRequest(t, context.Background(), "resource", http.Header{"If-None-Match": {`"v1"`}}),
+			newRequest(t, context.Background(), "resource", nil),
+		})
+		require.EqualValues(t, 4, atomic.LoadInt64(&calls))
+
+		reset()
+		close(release)
+		for i := 0; i < 2; i++ {
+			req, err := client.NewRequest(http.MethodPost, "resource", nil)
+			require.NoError(t, err)
+			_, err = client.Do(req, nil)
+			require.NoError(t, err)
+		}
+		require.EqualValues(t, 2, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("shares the error responses", func(t *testing.T) {
+		reset()
+		results := doAll(t, client, []*http.Request{
+			newRequest(t, context.Background(), "missing", nil),
+			newRequest(t, context.Background(), "missing", nil),
+		})
+		require.EqualValues(t, 1, atomic.LoadInt64(&calls))
+		for _, result := range results {
+			var httpErr *HTTPError
+			require.ErrorAs(t, result.err, &httpErr)
+			require.Equal(t, http.StatusNotFound, httpErr.Response.StatusCode)
+			require.JSONEq(t, `{"error": "not found"}`, string(httpErr.Raw))
+		}
+	})
+
+	t.Run("cancels the request only when all the waiters have gone", func(t *testing.T) {
+		reset()
+		ctx1, cancel1 := context.WithCancel(context.Background())
+		ctx2, cancel2 := context.WithCancel(context.Background())
+		defer cancel2()
+		errs := make(chan error, 2)
+		for _, ctx := range []context.Context{ctx1, ctx2} {
+			req := newRequest(t, ctx, "resource", nil)
+			go func() {
+				_, err := client.Do(req, nil)
+				errs <- err
+			}()
+		}
+		require.Eventually(t, func() bool { return waiters(client) == 2 }, time.Second, time.Millisecond)
+
+		cancel1()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		require.Equal(t, 1, waiters(client))
+		require.Zero(t, atomic.LoadInt64(&cancelled))
+
+		cancel2()
+		require.ErrorIs(t, <-errs, context.Canceled)
+		require.Eventually(t, func() bool { return atomic.LoadInt64(&cancelled) == 1 }, time.Second, time.Millisecond)
+		require.Zero(t, waiters(client))
+		require.EqualValues(t, 1, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("reads the body up to the size limits", func(t *testing.T) {
+		client := &Client{maxBodySize: 10, maxErrorBodySize: 100, maxWriterSize: 50}
+		require.EqualValues(t, 101, client.coalescingLimit())
+		client.maxWriterSize = 0
+		require.Zero(t, client.coalescingLimit())
+	})
+}
@@ -0,0 +1,199 @@
+package jsonclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieJar is an http.CookieJar which scopes the cookies to their domain
+// using the public suffix list (so that e.g. a cookie could not be set for
+// the whole `co.uk`), and persists them to a file with Save. Cookies without
+// expiration are persisted too, so that sessions survive restarts.
+type CookieJar struct {
+	path string
+
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	cookies map[string]persistedCookie
+}
+
+type persistedCookie struct {
+	URL      string        `json:"url"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Expires  time.Time     `json:"expires,omitempty"`
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"httpOnly,omitempty"`
+	SameSite http.SameSite `json:"sameSite,omitempty"`
+}
+
+// NewCookieJar creates a cookie jar persisted to the file at path, loading
+// the cookies already saved in it. If path is empty, the cookies are kept
+// only in memory.
+func NewCookieJar(path string) (*CookieJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	j := &CookieJar{path: path, jar: jar, cookies: map[string]persistedCookie{}}
+	if path == "" {
+		return j, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cookies []persistedCookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, c := range cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			continue
+		}
+		j.jar.SetCookies(u, []*http.Cookie{c.cookie()})
+		j.cookies[c.key()] = c
+	}
+	return j, nil
+}
+
+// SetCookies implements the http.CookieJar interface. The cookies are saved
+// to the file only by Save.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.jar.SetCookies(u, cookies)
+	now := time.Now()
+	for _, c := range cookies {
+		persisted := persistedCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			SameSite: c.SameSite,
+		}
+		if c.MaxAge > 0 {
+			persisted.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		j.cookies[persisted.key()] = persisted
+	}
+}
+
+// Cookies implements the http.CookieJar interface.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Save saves the cookies to the file, replacing it. Only the cookies still
+// sent by the jar to the url they were set for are saved: the expired, deleted
+// and rejected (e.g. set for a public suffix) ones are not.
+func (j *CookieJar) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.path == "" {
+		return nil
+	}
+
+	cookies := make([]persistedCookie, 0, len(j.cookies))
+	for key, c := range j.cookies {
+		if !j.isStored(c) {
+			delete(j.cookies, key)
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), "."+filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// isStored reports whether the jar sends the cookie to the url it was set for.
+func (j *CookieJar) isStored(c persistedCookie) bool {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return false
+	}
+	if c.Path != "" {
+		u.Path = c.Path
+	}
+	for _, stored := range j.jar.Cookies(u) {
+		if stored.Name == c.Name && stored.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c persistedCookie) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+// key identifies the cookie as the jar does: by name, domain and path.
+func (c persistedCookie) key() string {
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	path := c.Path
+	if u, err := url.Parse(c.URL); err == nil {
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		if path == "" {
+			path = u.Path
+			if i := strings.LastIndex(path, "/"); i > 0 {
+				path = path[:i]
+			} else {
+				path = "/"
+			}
+		}
+	}
+	return domain + ";" + path + ";" + c.Name
+}
@@ -0,0 +1,125 @@
+package jsonclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieJar(t *testing.T) {
+	cookieNames := func(jar http.CookieJar, rawURL string) []string {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		var names []string
+		for _, c := range jar.Cookies(u) {
+			names = append(names, c.Name+"="+c.Value)
+		}
+		return names
+	}
+
+	t.Run("public suffix aware domain scoping", func(t *testing.T) {
+		jar, err := NewCookieJar("")
+		require.NoError(t, err)
+		u, _ := url.Parse("https://www.example.co.uk/login")
+		jar.SetCookies(u, []*http.Cookie{
+			{Name: "suffix", Value: "1", Domain: "co.uk"},
+			{Name: "domain", Value: "2", Domain: "example.co.uk"},
+			{Name: "host", Value: "3"},
+		})
+
+		require.ElementsMatch(t, []string{"domain=2", "host=3"}, cookieNames(jar, "https://www.example.co.uk/"))
+		require.Equal(t, []string{"domain=2"}, cookieNames(jar, "https://api.example.co.uk/"))
+		require.Empty(t, cookieNames(jar, "https://other.co.uk/"))
+	})
+
+	t.Run("persists the cookies", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cookies.json")
+		jar, err := NewCookieJar(path)
+		require.NoError(t, err)
+		u, _ := url.Parse("https://api.example.com/v1/login")
+		jar.SetCookies(u, []*http.Cookie{
+			{Name: "session", Value: "abc", Path: "/", HttpOnly: true},
+			{Name: "expiring", Value: "1", MaxAge: 3600},
+			{Name: "suffix", Value: "1", Domain: "com"},
+		})
+		jar.SetCookies(u, []*http.Cookie{{Name: "expiring", Value: "2", MaxAge: 3600}})
+		_, err = os.Stat(path)
+		require.ErrorIs(t, err, os.ErrNotExist, "cookies should be saved only by Save")
+		require.NoError(t, jar.Save())
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		loaded, err := NewCookieJar(path)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"session=abc", "expiring=2"}, cookieNames(loaded, "https://api.example.com/v1/items"))
+		require.Len(t, loaded.cookies, 2)
+
+		loaded.SetCookies(u, []*http.Cookie{{Name: "expiring", MaxAge: -1}})
+		require.NoError(t, loaded.Save())
+		loaded, err = NewCookieJar(path)
+		require.NoError(t, err)
+		require.Equal(t, []string{"session=abc"}, cookieNames(loaded, "https://api.example.com/v1/items"))
+	})
+
+	t.Run("persists the cookies with a path set from another path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cookies.json")
+		jar, err := NewCookieJar(path)
+		require.NoError(t, err)
+		u, _ := url.Parse("https://example.com/login")
+		jar.SetCookies(u, []*http.Cookie{{Name: "api", Value: "1", Path: "/api"}, {Name: "domain", Value: "2", Domain: "example.com"}})
+		require.NoError(t, jar.Save())
+
+		loaded, err := NewCookieJar(path)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"api=1", "domain=2"}, cookieNames(loaded, "https://example.com/api/items"))
+		require.Equal(t, []string{"domain=2"}, cookieNames(loaded, "https://www.example.com/login"))
+	})
+
+	t.Run("returns the save errors", func(t *testing.T) {
+		jar, err := NewCookieJar(filepath.Join(t.TempDir(), "missing", "cookies.json"))
+		require.NoError(t, err)
+		u, _ := url.Parse("https://example.com/")
+		jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "abc"}})
+		require.Error(t, jar.Save())
+	})
+
+	t.Run("client option", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/set" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+				return
+			}
+			cookie, err := req.Cookie("session")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"session": "` + cookie.Value + `"}`))
+		}))
+		defer server.Close()
+
+		jar, err := NewCookieJar(filepath.Join(t.TempDir(), "cookies.json"))
+		require.NoError(t, err)
+		client, err := New(Options{BaseURL: server.URL, CookieJar: jar})
+		require.NoError(t, err)
+		require.Nil(t, http.DefaultClient.Jar)
+
+		req, err := client.NewRequest(http.MethodGet, "set", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.NoError(t, err)
+
+		req, err = client.NewRequest(http.MethodGet, "get", nil)
+		require.NoError(t, err)
+		var v map[string]string
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, "abc", v["session"])
+	})
+}
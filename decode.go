@@ -0,0 +1,223 @@
+package jsonclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// snippetRadius is the number of bytes kept, before and after the failure
+// offset, in the DecodeError snippet.
+const snippetRadius = 40
+
+// decodeContextSize is the size of the beginning of the body kept, when it is
+// not strictly decoded, to set the path and the snippet of a DecodeError.
+const decodeContextSize = 64 << 10
+
+// DecodeError struct define a failure decoding a successful response body.
+// Path is the JSON pointer of the value where the decoding failed, Offset its
+// byte offset in the body and Snippet a truncated part of the body around it.
+// Without strict decoding, Path and Snippet are empty for the failures after
+// the first 64 KiB of the body, which is not buffered.
+// Err is the underlying error (e.g. *json.SyntaxError or *json.UnmarshalTypeError).
+type DecodeError struct {
+	Method      string
+	URL         string
+	StatusCode  int
+	ContentType string
+	Path        string
+	Offset      int64
+	Snippet     string
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s %s: %d: decoding %s at %s (offset %d): %s, near %q",
+		e.Method,
+		e.URL,
+		e.StatusCode,
+		e.ContentType,
+		path,
+		e.Offset,
+		e.Err,
+		e.Snippet,
+	)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeResponse decodes the response body into v. The body is buffered only
+// by the strict decoding, which reads it again to describe the failures:
+// otherwise it is decoded while read, keeping only its beginning.
+func decodeResponse(resp *http.Response, v interface{}, strict bool) error {
+	if strict {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return newDecodeError(resp, data, int64(len(data)), decodeStrict(resp, data, v))
+	}
+
+	head := &headWriter{limit: decodeContextSize}
+	err := json.NewDecoder(io.TeeReader(resp.Body, head)).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return newDecodeError(resp, head.data, head.size, err)
+}
+
+// headWriter keeps the first limit bytes written, counting all of them.
+type headWriter struct {
+	limit int
+	data  []byte
+	size  int64
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if free := w.limit - len(w.data); free > 0 {
+		if len(p) < free {
+			free = len(p)
+		}
+		w.data = append(w.data, p[:free]...)
+	}
+	w.size += int64(len(p))
+	return len(p), nil
+}
+
+// newDecodeError wraps json syntax and type errors in a DecodeError. Other
+// errors are returned as is. data is the beginning of the body, of size
+// bytes: the path and the snippet are set only if the failure is within it.
+func newDecodeError(resp *http.Response, data []byte, size int64, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		offset = size
+	default:
+		return err
+	}
+
+	decodeErr := &DecodeError{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Offset:      offset,
+		Err:         err,
+	}
+	if offset <= int64(len(data)) {
+		decodeErr.Path = jsonPathAt(data, offset)
+		decodeErr.Snippet = snippet(data, offset)
+	}
+	if resp.Request != nil {
+		decodeErr.Method = resp.Request.Method
+		decodeErr.URL = resp.Request.URL.String()
+	}
+	return decodeErr
+}
+
+func snippet(data []byte, offset int64) string {
+	start := offset - snippetRadius
+	prefix := "..."
+	if start <= 0 {
+		start = 0
+		prefix = ""
+	}
+	end := offset + snippetRadius
+	suffix := "..."
+	if end >= int64(len(data)) {
+		end = int64(len(data))
+		suffix = ""
+	}
+	if start > end {
+		start = end
+	}
+	return prefix + string(data[start:end]) + suffix
+}
+
+type pathFrame struct {
+	object    bool
+	expectKey bool
+	key       string
+	index     int
+}
+
+// jsonPathAt returns the JSON pointer of the value at the passed offset.
+func jsonPathAt(data []byte, offset int64) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var stack []*pathFrame
+
+	path := func() string {
+		var b strings.Builder
+		for _, frame := range stack {
+			switch {
+			case frame.object && !frame.expectKey:
+				b.WriteString("/" + escapeJSONPointer(frame.key))
+			case !frame.object:
+				b.WriteString("/" + strconv.Itoa(frame.index))
+			}
+		}
+		return b.String()
+	}
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return path()
+		}
+		end := dec.InputOffset()
+
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if key, ok := tok.(string); ok && top.object && top.expectKey {
+				top.key = key
+				top.expectKey = false
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if end >= offset {
+				return path()
+			}
+			stack = append(stack, &pathFrame{object: tok == json.Delim('{'), expectKey: true})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if end >= offset {
+				return path()
+			}
+			valueDone()
+		default:
+			if end >= offset {
+				return path()
+			}
+			valueDone()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeError(t *testing.T) {
+	type Item struct {
+		ID int `json:"id"`
+	}
+	type Response struct {
+		Name  string `json:"name"`
+		Items []Item `json:"items"`
+	}
+
+	var body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+	}))
+	defer s.Close()
+
+	client, err := New(Options{BaseURL: s.URL})
+	require.NoError(t, err)
+
+	do := func(t *testing.T, responseBody string) error {
+		t.Helper()
+		body = responseBody
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodGet, "resource", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, &Response{})
+		return err
+	}
+
+	t.Run("type error", func(t *testing.T) {
+		err := do(t, `{"name": "a", "items": [{"id": 1}, {"id": "2"}]}`)
+
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, http.MethodGet, decodeErr.Method)
+		require.Equal(t, s.URL+"/resource", decodeErr.URL)
+		require.Equal(t, http.StatusOK, decodeErr.StatusCode)
+		require.Equal(t, "application/json", decodeErr.ContentType)
+		require.Equal(t, "/items/1/id", decodeErr.Path)
+		require.Equal(t, int64(45), decodeErr.Offset)
+		require.Equal(t, `...e": "a", "items": [{"id": 1}, {"id": "2"}]}`, decodeErr.Snippet)
+
+		var typeErr *json.UnmarshalTypeError
+		require.True(t, errors.As(err, &typeErr))
+		require.EqualError(t, err, `GET `+s.URL+`/resource: 200: decoding application/json at /items/1/id (offset 45): `+typeErr.Error()+`, near "...e\": \"a\", \"items\": [{\"id\": 1}, {\"id\": \"2\"}]}"`)
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		err := do(t, `{"name": "a", "items": [{"id": 1}, {"id" 2}]}`)
+
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, "/items/1/id", decodeErr.Path)
+		require.Equal(t, int64(42), decodeErr.Offset)
+
+		var syntaxErr *json.SyntaxError
+		require.True(t, errors.As(err, &syntaxErr))
+	})
+
+	t.Run("truncated body", func(t *testing.T) {
+		err := do(t, `{"name": "a", "items": [`)
+
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+		require.Equal(t, int64(24), decodeErr.Offset)
+		require.Equal(t, "/items", decodeErr.Path)
+	})
+
+	t.Run("keeps only the beginning of the body", func(t *testing.T) {
+		name := strings.Repeat("a", decodeContextSize)
+		require.NoError(t, do(t, `{"name": "`+name+`", "items": [{"id": 1}]}`))
+
+		err := do(t, `{"name": "`+name+`", "items": [{"id": "1"}]}`)
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, int64(len(name)+33), decodeErr.Offset)
+		require.Empty(t, decodeErr.Path)
+		require.Empty(t, decodeErr.Snippet)
+	})
+
+	t.Run("truncates the snippet", func(t *testing.T) {
+		err := do(t, `{"name": "`+strings.Repeat("a", 100)+`", "items": "no", "other": "`+strings.Repeat("b", 100)+`"}`)
+
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, "/items", decodeErr.Path)
+		require.Len(t, decodeErr.Snippet, 2*snippetRadius+6)
+		require.True(t, strings.HasPrefix(decodeErr.Snippet, "...aaa"))
+		require.True(t, strings.HasSuffix(decodeErr.Snippet, "bbb..."))
+		require.Contains(t, decodeErr.Snippet, `"items": "no"`)
+	})
+}
+
+func TestJSONPathAt(t *testing.T) {
+	data := []byte(`{"a": {"b/c": [1, {"d": true}]}, "e": null}`)
+	tests := map[int64]string{
+		0:  "",
+		1:  "",
+		5:  "/a",
+		16: "/a/b~1c/0",
+		27: "/a/b~1c/1/d",
+		41: "/e",
+	}
+	for offset, expected := range tests {
+		require.Equal(t, expected, jsonPathAt(data, offset), "offset %d", offset)
+	}
+}
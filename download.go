@@ -0,0 +1,403 @@
+package jsonclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Download integrity checks
+const (
+	CheckContentLength = "Content-Length"
+	CheckContentDigest = "Content-Digest"
+	CheckReprDigest    = "Repr-Digest"
+	CheckChecksum      = "checksum"
+)
+
+// ErrIntegrity define a downloaded content not matching its expected size or digest
+var ErrIntegrity = errors.New("download integrity check failed")
+
+// ErrInvalidContentRange define a partial response not matching the requested range
+var ErrInvalidContentRange = errors.New("invalid content range")
+
+// IntegrityError struct define a download failing one of the integrity
+// checks. Check is one of CheckContentLength, CheckContentDigest,
+// CheckReprDigest or CheckChecksum. Expected and Actual are the sizes, or the
+// hex encoded digests, compared.
+type IntegrityError struct {
+	Check     string
+	Algorithm string
+	Expected  string
+	Actual    string
+	Err       error
+}
+
+func (e *IntegrityError) Error() string {
+	check := e.Check
+	if e.Algorithm != "" {
+		check += " " + e.Algorithm
+	}
+	return fmt.Sprintf("%s: %s mismatch: expected %s, got %s", e.Err, check, e.Expected, e.Actual)
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// DownloadOptions struct define the options of Client.Download.
+type DownloadOptions struct {
+	// Progress, if set, is called after each chunk written with the number of
+	// bytes written and the total size, or -1 if the size is unknown.
+	Progress func(written, total int64)
+	// MaxResumes is the maximum number of times an interrupted transfer is
+	// resumed with a Range request. Zero means no resume.
+	MaxResumes int
+	// Hash and Checksum, if set, verify the downloaded content against a
+	// caller supplied digest. They must be both set.
+	Hash     hash.Hash
+	Checksum []byte
+}
+
+// Download performs the request and writes the response body to the file at
+// path. The body is written to a temporary file in the same directory, which
+// is renamed to path (with 0644 permissions) only if the transfer completes
+// and the integrity checks pass: the Content-Length, the RFC 9530
+// Content-Digest and Repr-Digest response headers (sha-256 and sha-512 are
+// supported) and opts.Checksum.
+//
+// Interrupted transfers are resumed, up to opts.MaxResumes times, with a Range
+// request conditioned by If-Range on the ETag or Last-Modified of the response.
+// The returned response is the last one received, with its body closed.
+func (c *Client) Download(req *http.Request, path string, opts DownloadOptions) (*http.Response, error) {
+	if (opts.Hash == nil) != (opts.Checksum == nil) {
+		closeBody(req)
+		return nil, fmt.Errorf("download hash and checksum must be both set")
+	}
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, "."+name+".*.part")
+	if err != nil {
+		return nil, err
+	}
+
+	d := &download{client: c, opts: opts, file: file, total: -1}
+	resp, err := d.run(req)
+	if err == nil {
+		err = file.Chmod(0o644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return resp, nil
+}
+
+type download struct {
+	client  *Client
+	opts    DownloadOptions
+	file    *os.File
+	written int64
+	total   int64
+}
+
+func (d *download) run(req *http.Request) (*http.Response, error) {
+	current := req
+	var validator string
+	for resumes := 0; ; resumes++ {
+		resp, interrupted, err := d.fetch(current)
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil && resumes == 0 {
+			validator = resumeValidator(resp)
+		}
+		if interrupted == nil {
+			return resp, d.verify(resp)
+		}
+
+		if resumes >= d.opts.MaxResumes || validator == "" || req.Context().Err() != nil {
+			return nil, interrupted
+		}
+		current, err = resumeRequest(req, d.written, validator)
+		if err != nil {
+			return nil, interrupted
+		}
+	}
+}
+
+// fetch performs the request and copies the body to the file. Failures
+// which could be resumed are returned as interrupted. The request is sent
+// like the ones of Do, except that it is never coalesced, to not buffer the
+// downloaded content.
+func (d *download) fetch(req *http.Request) (resp *http.Response, interrupted error, err error) {
+	resp, done, err := d.client.exchange(req, d.client.sendToEndpoint)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+		var urlErr *url.Error
+		if req.Header.Get("Range") != "" && errors.As(err, &urlErr) {
+			return nil, err, nil
+		}
+		return nil, nil, err
+	}
+	defer done()
+
+	if resp.StatusCode == http.StatusPartialContent {
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if start != d.written {
+			return nil, nil, fmt.Errorf("%w: expected start %d, got %d", ErrInvalidContentRange, d.written, start)
+		}
+		d.total = total
+	} else {
+		if d.written > 0 {
+			if err := d.restart(); err != nil {
+				return nil, nil, err
+			}
+		}
+		d.total = resp.ContentLength
+		if resp.Uncompressed {
+			d.total = -1
+		}
+	}
+
+	var body io.Reader = resp.Body
+	if limit := d.client.maxWriterSize; limit > 0 {
+		body = &limitedReader{r: resp.Body, limit: limit, read: d.written}
+	}
+
+	var digest *digestCheck
+	if !resp.Uncompressed {
+		digest = newDigestCheck(CheckContentDigest, resp.Header.Get("Content-Digest"))
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err := d.file.Write(buf[:n]); err != nil {
+				return nil, nil, err
+			}
+			if digest != nil {
+				digest.hash.Write(buf[:n])
+			}
+			d.written += int64(n)
+			if d.opts.Progress != nil {
+				d.opts.Progress(d.written, d.total)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			var tooLarge *BodyTooLargeError
+			if errors.As(readErr, &tooLarge) {
+				return nil, nil, readErr
+			}
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			return resp, readErr, nil
+		}
+	}
+
+	if d.total >= 0 && d.written != d.total {
+		return nil, nil, &IntegrityError{
+			Check:    CheckContentLength,
+			Expected: strconv.FormatInt(d.total, 10),
+			Actual:   strconv.FormatInt(d.written, 10),
+			Err:      ErrIntegrity,
+		}
+	}
+	if digest != nil {
+		if err := digest.verify(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return resp, nil, nil
+}
+
+// restart discards the data written, when the server sends the whole content
+// instead of the requested range.
+func (d *download) restart() error {
+	if err := d.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	d.written = 0
+	return nil
+}
+
+// verify checks the whole file against the Repr-Digest of the response and
+// the caller checksum.
+func (d *download) verify(resp *http.Response) error {
+	var checks []*digestCheck
+	if !resp.Uncompressed {
+		if digest := newDigestCheck(CheckReprDigest, resp.Header.Get("Repr-Digest")); digest != nil {
+			checks = append(checks, digest)
+		}
+	}
+	if d.opts.Hash != nil {
+		d.opts.Hash.Reset()
+		checks = append(checks, &digestCheck{check: CheckChecksum, hash: d.opts.Hash, expected: d.opts.Checksum})
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	writers := make([]io.Writer, 0, len(checks))
+	for _, check := range checks {
+		writers = append(writers, check.hash)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), d.file); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if err := check.verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeValidator returns the validator to use in If-Range: the ETag if it is
+// strong, otherwise the Last-Modified date.
+func resumeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+func resumeRequest(req *http.Request, offset int64, validator string) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("request body can not be replayed")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	next.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	next.Header.Set("If-Range", validator)
+	return next, nil
+}
+
+// parseContentRange parses a `bytes start-end/total` Content-Range header.
+// The total is -1 if unknown.
+func parseContentRange(value string) (start, total int64, err error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidContentRange, value)
+	rangeSpec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, invalid
+	}
+	byteRange, size, ok := strings.Cut(rangeSpec, "/")
+	if !ok {
+		return 0, 0, invalid
+	}
+	first, last, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, invalid
+	}
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, invalid
+	}
+	if size == "*" {
+		return start, -1, nil
+	}
+	total, err = strconv.ParseInt(size, 10, 64)
+	if err != nil || total <= end {
+		return 0, 0, invalid
+	}
+	return start, total, nil
+}
+
+type digestCheck struct {
+	check     string
+	algorithm string
+	hash      hash.Hash
+	expected  []byte
+}
+
+// newDigestCheck parses an RFC 9530 digest header, e.g.
+// `sha-256=:base64digest:`, preferring the strongest supported algorithm.
+// It returns nil if the header has no supported digest.
+func newDigestCheck(check, value string) *digestCheck {
+	digests := map[string][]byte{}
+	for _, member := range strings.Split(value, ",") {
+		key, item, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			continue
+		}
+		item, _, _ = strings.Cut(item, ";")
+		if len(item) < 2 || item[0] != ':' || item[len(item)-1] != ':' {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(item[1 : len(item)-1])
+		if err != nil {
+			continue
+		}
+		digests[strings.ToLower(key)] = digest
+	}
+
+	if digest, ok := digests["sha-512"]; ok {
+		return &digestCheck{check: check, algorithm: "sha-512", hash: sha512.New(), expected: digest}
+	}
+	if digest, ok := digests["sha-256"]; ok {
+		return &digestCheck{check: check, algorithm: "sha-256", hash: sha256.New(), expected: digest}
+	}
+	return nil
+}
+
+func (d *digestCheck) verify() error {
+	actual := d.hash.Sum(nil)
+	if bytes.Equal(actual, d.expected) {
+		return nil
+	}
+	return &IntegrityError{
+		Check:     d.check,
+		Algorithm: d.algorithm,
+		Expected:  hex.EncodeToString(d.expected),
+		Actual:    hex.EncodeToString(actual),
+		Err:       ErrIntegrity,
+	}
+}
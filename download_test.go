@@ -0,0 +1,267 @@
+package jsonclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownload(t *testing.T) {
+	modTime := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := sha256.Sum256(content)
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	newServer := func(t *testing.T, handler http.HandlerFunc) *Client {
+		t.Helper()
+		s := httptest.NewServer(handler)
+		t.Cleanup(s.Close)
+		client, err := New(Options{BaseURL: s.URL})
+		require.NoError(t, err)
+		return client
+	}
+	newRequest := func(t *testing.T, client *Client) *http.Request {
+		t.Helper()
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodGet, "file", nil)
+		require.NoError(t, err)
+		return req
+	}
+	requireNoTempFiles := func(t *testing.T, dir string) {
+		t.Helper()
+		matches, err := filepath.Glob(filepath.Join(dir, ".*.part"))
+		require.NoError(t, err)
+		require.Empty(t, matches)
+	}
+
+	t.Run("writes the file and reports progress", func(t *testing.T) {
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("Content-Digest", digest)
+			w.Write(content)
+		})
+		dir := t.TempDir()
+		path := filepath.Join(dir, "file.bin")
+
+		var lastWritten, lastTotal int64
+		resp, err := client.Download(newRequest(t, client), path, DownloadOptions{
+			Progress: func(written, total int64) {
+				require.Greater(t, written, lastWritten)
+				lastWritten, lastTotal = written, total
+			},
+			Hash:     sha256.New(),
+			Checksum: sum[:],
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, int64(len(content)), lastWritten)
+		require.Equal(t, int64(len(content)), lastTotal)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+		requireNoTempFiles(t, dir)
+	})
+
+	t.Run("rejects digest mismatches", func(t *testing.T) {
+		tests := map[string]struct {
+			header   string
+			check    string
+			checksum []byte
+		}{
+			"content digest": {header: "Content-Digest", check: CheckContentDigest},
+			"repr digest":    {header: "Repr-Digest", check: CheckReprDigest},
+			"checksum":       {check: CheckChecksum, checksum: make([]byte, sha256.Size)},
+		}
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+					if test.header != "" {
+						w.Header().Set(test.header, "sha-256=:"+base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))+":")
+					}
+					w.Write(content)
+				})
+				dir := t.TempDir()
+				path := filepath.Join(dir, "file.bin")
+
+				opts := DownloadOptions{}
+				if test.checksum != nil {
+					opts.Hash = sha256.New()
+					opts.Checksum = test.checksum
+				}
+				resp, err := client.Download(newRequest(t, client), path, opts)
+				require.Nil(t, resp)
+				require.True(t, errors.Is(err, ErrIntegrity))
+				var integrityErr *IntegrityError
+				require.True(t, errors.As(err, &integrityErr))
+				require.Equal(t, test.check, integrityErr.Check)
+				require.Equal(t, "0000000000000000000000000000000000000000000000000000000000000000", integrityErr.Expected)
+
+				_, err = os.Stat(path)
+				require.True(t, os.IsNotExist(err))
+				requireNoTempFiles(t, dir)
+			})
+		}
+	})
+
+	t.Run("resumes interrupted transfers", func(t *testing.T) {
+		var ranges []string
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			ranges = append(ranges, req.Header.Get("Range"))
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Repr-Digest", digest)
+			if req.Header.Get("Range") == "" {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.Write(content[:40000])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			require.Equal(t, `"v1"`, req.Header.Get("If-Range"))
+			http.ServeContent(w, req, "", modTime, bytes.NewReader(content))
+		})
+		dir := t.TempDir()
+		path := filepath.Join(dir, "file.bin")
+
+		resp, err := client.Download(newRequest(t, client), path, DownloadOptions{MaxResumes: 1})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		require.Equal(t, []string{"", "bytes=40000-"}, ranges)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+	})
+
+	t.Run("restarts if the content changed", func(t *testing.T) {
+		calls := 0
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			if calls == 1 {
+				w.Write(bytes.Repeat([]byte("x"), 40000))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.Write(content)
+		})
+		dir := t.TempDir()
+		path := filepath.Join(dir, "file.bin")
+
+		resp, err := client.Download(newRequest(t, client), path, DownloadOptions{MaxResumes: 3})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+	})
+
+	t.Run("returns interrupted transfers without resumes", func(t *testing.T) {
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:40000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		})
+		dir := t.TempDir()
+		path := filepath.Join(dir, "file.bin")
+
+		resp, err := client.Download(newRequest(t, client), path, DownloadOptions{})
+		require.Nil(t, resp)
+		require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+		requireNoTempFiles(t, dir)
+	})
+
+	t.Run("returns http errors", func(t *testing.T) {
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		path := filepath.Join(t.TempDir(), "file.bin")
+
+		_, err := client.Download(newRequest(t, client), path, DownloadOptions{})
+		require.True(t, errors.Is(err, ErrHTTP))
+	})
+
+	t.Run("sends the request through the endpoint pool", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+		up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write(content)
+		}))
+		defer up.Close()
+		client, err := New(Options{Endpoints: &EndpointPool{BaseURLs: []string{down.URL, up.URL}}})
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "file.bin")
+
+		for i := 0; i < 2; i++ {
+			_, err = client.Download(newRequest(t, client), path, DownloadOptions{})
+			require.NoError(t, err)
+			written, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, content, written)
+		}
+	})
+
+	t.Run("throws with hash without checksum", func(t *testing.T) {
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			w.Write(content)
+		})
+		dir := t.TempDir()
+
+		_, err := client.Download(newRequest(t, client), filepath.Join(dir, "file.bin"), DownloadOptions{Hash: sha256.New()})
+		require.EqualError(t, err, "download hash and checksum must be both set")
+		requireNoTempFiles(t, dir)
+	})
+
+	t.Run("Do returns writer copy errors", func(t *testing.T) {
+		client := newServer(t, func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:40000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		})
+
+		resp, err := client.Do(newRequest(t, client), &bytes.Buffer{})
+		require.Nil(t, resp)
+		require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	})
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, err := parseContentRange("bytes 10-19/20")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), start)
+	require.Equal(t, int64(20), total)
+
+	start, total, err = parseContentRange("bytes 10-19/*")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), start)
+	require.Equal(t, int64(-1), total)
+
+	for _, value := range []string{"", "bytes */20", "bytes 10-9/20", "bytes 10-19/19", "items 1-2/3"} {
+		_, _, err := parseContentRange(value)
+		require.True(t, errors.Is(err, ErrInvalidContentRange), value)
+	}
+}
+
+func TestNewDigestCheck(t *testing.T) {
+	require.Nil(t, newDigestCheck(CheckContentDigest, ""))
+	require.Nil(t, newDigestCheck(CheckContentDigest, "md5=:AAAA:"))
+
+	check := newDigestCheck(CheckContentDigest, "sha-256=:AAAA:, sha-512=:AAAA:;x=1")
+	require.Equal(t, "sha-512", check.algorithm)
+	require.Equal(t, []byte{0, 0, 0}, check.expected)
+}
@@ -0,0 +1,467 @@
+package jsonclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Load balancing strategies of an EndpointPool
+const (
+	// RoundRobin sends the requests to the healthy endpoints in turn.
+	RoundRobin LoadBalancing = iota
+	// PriorityFailover sends the requests to the first healthy endpoint, in
+	// the order of BaseURLs.
+	PriorityFailover
+	// LeastOutstanding sends the requests to the healthy endpoint with the
+	// fewest requests in flight.
+	LeastOutstanding
+	// ConsistentHash sends the requests with the same key to the same
+	// endpoint, while it is healthy and not overloaded. Requests without key
+	// are sent in turn.
+	ConsistentHash
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultMaxFailures         = 3
+)
+
+// LoadBalancing define how an EndpointPool selects the endpoint of a request.
+type LoadBalancing int
+
+// EndpointPool struct define a pool of base urls. Requests created with
+// NewRequestWithContext and a relative url are resolved against the endpoint
+// selected when the request is sent.
+//
+// Endpoints are ejected after MaxFailures consecutive failures (transport
+// errors or 5xx responses) and re-admitted when a health-check request,
+// sent every HealthCheckInterval, succeeds. Idempotent requests failing with a
+// transport error are retried on the other endpoints.
+type EndpointPool struct {
+	// BaseURLs of the endpoints, in priority order.
+	BaseURLs []string
+	// Strategy is the load balancing strategy. Default to RoundRobin.
+	Strategy LoadBalancing
+	// HealthCheckPath is the path, relative to the endpoint base url,
+	// requested with GET to check an ejected endpoint. A 2xx response
+	// re-admits it.
+	HealthCheckPath string
+	// HealthCheckInterval is the interval between health checks of an
+	// ejected endpoint. Default to 10 seconds.
+	HealthCheckInterval time.Duration
+	// MaxFailures is the number of consecutive failures which ejects an
+	// endpoint. Default to 3.
+	MaxFailures int
+
+	// HashHeader is the request header used as key by the ConsistentHash
+	// strategy.
+	HashHeader string
+	// HashPathParam is the URI template variable used as key by the
+	// ConsistentHash strategy, for requests created with
+	// NewTemplateRequestWithContext.
+	HashPathParam string
+	// HashReplicas is the number of virtual nodes of each endpoint on the
+	// hash ring. Default to 100.
+	HashReplicas int
+	// LoadFactor bounds the outstanding requests of an endpoint, with the
+	// ConsistentHash strategy, to LoadFactor times the average: keys of an
+	// overloaded endpoint are sent to the next one on the ring. Default to 1.25.
+	LoadFactor float64
+}
+
+// EndpointStatus struct define the state of an endpoint of the pool.
+type EndpointStatus struct {
+	BaseURL             string
+	Healthy             bool
+	Outstanding         int
+	ConsecutiveFailures int
+}
+
+type endpoint struct {
+	baseURL *url.URL
+
+	healthy     bool
+	removed     bool
+	outstanding int
+	failures    int
+}
+
+type endpointPool struct {
+	config EndpointPool
+	client *http.Client
+	// ctx is cancelled by Close, stopping the health checks.
+	ctx    context.Context
+	cancel context.CancelFunc
+	checks sync.WaitGroup
+	// tick returns the ticks of the health checks and the func stopping them.
+	tick func(time.Duration) (<-chan time.Time, func())
+
+	mtx       sync.Mutex
+	endpoints []*endpoint
+	ring      *hashRing
+	next      int
+}
+
+// endpointRefKey marks the requests created with a url relative to the base
+// url, sent to the endpoints of the pool.
+type endpointRefKey struct{}
+
+func newEndpointPool(config EndpointPool, client *http.Client) (*endpointPool, error) {
+	if len(config.BaseURLs) == 0 {
+		return nil, fmt.Errorf("endpoint pool without base urls")
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = defaultHealthCheckInterval
+	}
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = defaultMaxFailures
+	}
+	if config.HashReplicas <= 0 {
+		config.HashReplicas = defaultHashReplicas
+	}
+	if config.LoadFactor < 1 {
+		config.LoadFactor = defaultHashLoadFactor
+	}
+
+	pool := &endpointPool{config: config, client: client, tick: newTicks}
+	for _, baseURL := range config.BaseURLs {
+		e, err := newEndpoint(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		pool.endpoints = append(pool.endpoints, e)
+	}
+	pool.ring = newHashRing(pool.endpoints, config.HashReplicas)
+	pool.ctx, pool.cancel = context.WithCancel(context.Background())
+	return pool, nil
+}
+
+func newEndpoint(baseURL string) (*endpoint, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("empty endpoint base url")
+	}
+	u, err := parseBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint{baseURL: u, healthy: true}, nil
+}
+
+// AddEndpoint adds an endpoint to the pool. With the ConsistentHash strategy,
+// only the keys mapped to the new endpoint are moved.
+func (c *Client) AddEndpoint(baseURL string) error {
+	if c.pool == nil {
+		return fmt.Errorf("client without endpoint pool")
+	}
+	e, err := newEndpoint(baseURL)
+	if err != nil {
+		return err
+	}
+
+	c.pool.mtx.Lock()
+	defer c.pool.mtx.Unlock()
+	for _, existing := range c.pool.endpoints {
+		if existing.baseURL.String() == e.baseURL.String() {
+			return fmt.Errorf("endpoint %s already in the pool", e.baseURL)
+		}
+	}
+	c.pool.endpoints = append(c.pool.endpoints, e)
+	c.pool.ring = newHashRing(c.pool.endpoints, c.pool.config.HashReplicas)
+	return nil
+}
+
+// RemoveEndpoint removes an endpoint from the pool. With the ConsistentHash
+// strategy, only the keys mapped to the removed endpoint are moved. The
+// requests in flight to the endpoint are not interrupted.
+func (c *Client) RemoveEndpoint(baseURL string) error {
+	if c.pool == nil {
+		return fmt.Errorf("client without endpoint pool")
+	}
+	u, err := parseBaseURL(baseURL)
+	if err != nil {
+		return err
+	}
+
+	c.pool.mtx.Lock()
+	defer c.pool.mtx.Unlock()
+	for i, e := range c.pool.endpoints {
+		if e.baseURL.String() != u.String() {
+			continue
+		}
+		if len(c.pool.endpoints) == 1 {
+			return fmt.Errorf("cannot remove the last endpoint")
+		}
+		e.removed = true
+		c.pool.endpoints = append(c.pool.endpoints[:i:i], c.pool.endpoints[i+1:]...)
+		c.pool.ring = newHashRing(c.pool.endpoints, c.pool.config.HashReplicas)
+		return nil
+	}
+	return fmt.Errorf("endpoint %s not in the pool", u)
+}
+
+// Close stops the health checks of the ejected endpoints of the pool, if
+// any, which are no longer re-admitted. The client could still send requests.
+func (c *Client) Close() error {
+	if c.pool != nil {
+		c.pool.close()
+	}
+	return nil
+}
+
+// Endpoints returns the state of the endpoints of the pool, or nil if the
+// client has no EndpointPool.
+func (c *Client) Endpoints() []EndpointStatus {
+	if c.pool == nil {
+		return nil
+	}
+	c.pool.mtx.Lock()
+	defer c.pool.mtx.Unlock()
+
+	statuses := make([]EndpointStatus, 0, len(c.pool.endpoints))
+	for _, e := range c.pool.endpoints {
+		statuses = append(statuses, EndpointStatus{
+			BaseURL:             e.baseURL.String(),
+			Healthy:             e.healthy,
+			Outstanding:         e.outstanding,
+			ConsecutiveFailures: e.failures,
+		})
+	}
+	return statuses
+}
+
+// pick selects an endpoint for the request not already tried, and counts the
+// request as outstanding. If all the endpoints not tried are ejected, they are
+// used anyway. It returns nil if all the endpoints were tried.
+func (p *endpointPool) pick(req *http.Request, tried map[*endpoint]bool) *endpoint {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var candidates []*endpoint
+	for _, e := range p.endpoints {
+		if !tried[e] && e.healthy {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, e := range p.endpoints {
+			if !tried[e] {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	strategy := p.config.Strategy
+	if strategy == ConsistentHash {
+		if key, ok := p.requestHashKey(req); ok {
+			if selected := p.pickHashed(key, candidates); selected != nil {
+				selected.outstanding++
+				return selected
+			}
+		}
+		strategy = RoundRobin
+	}
+
+	selected := candidates[0]
+	switch strategy {
+	case RoundRobin:
+		selected = candidates[p.next%len(candidates)]
+		p.next++
+	case LeastOutstanding:
+		for _, e := range candidates[1:] {
+			if e.outstanding < selected.outstanding {
+				selected = e
+			}
+		}
+	}
+	selected.outstanding++
+	return selected
+}
+
+func (p *endpointPool) release(e *endpoint) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	e.outstanding--
+}
+
+func (p *endpointPool) success(e *endpoint) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	e.failures = 0
+}
+
+// failure counts a failure of the endpoint, ejecting it if the failures are
+// too many. Once the pool is closed, ejected endpoints are not checked.
+func (p *endpointPool) failure(e *endpoint) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	e.failures++
+	if e.healthy && e.failures >= p.config.MaxFailures {
+		e.healthy = false
+		if p.ctx.Err() == nil {
+			p.checks.Add(1)
+			go p.healthCheck(e)
+		}
+	}
+}
+
+// close stops the health checks, waiting for them to return.
+func (p *endpointPool) close() {
+	p.mtx.Lock()
+	p.cancel()
+	p.mtx.Unlock()
+	p.checks.Wait()
+}
+
+func newTicks(interval time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// healthCheck checks the ejected endpoint periodically, until it is healthy
+// or the pool is closed.
+func (p *endpointPool) healthCheck(e *endpoint) {
+	defer p.checks.Done()
+	ticks, stop := p.tick(p.config.HealthCheckInterval)
+	defer stop()
+	for {
+		select {
+		case <-ticks:
+		case <-p.ctx.Done():
+			return
+		}
+		p.mtx.Lock()
+		removed := e.removed
+		p.mtx.Unlock()
+		if removed {
+			return
+		}
+		if p.check(e) {
+			p.mtx.Lock()
+			e.healthy = true
+			e.failures = 0
+			p.mtx.Unlock()
+			return
+		}
+	}
+}
+
+func (p *endpointPool) check(e *endpoint) bool {
+	u, err := e.baseURL.Parse(p.config.HealthCheckPath)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, p.config.HealthCheckInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	drainAndClose(resp.Body)
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// do sends the request to an endpoint of the pool, resolving ref against its
+// base url. Idempotent requests failing with a transport error are retried on
+// the other endpoints.
+func (p *endpointPool) do(req *http.Request, ref string, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	tried := map[*endpoint]bool{}
+	var firstErr error
+	for {
+		e := p.pick(req, tried)
+		if e == nil {
+			return nil, firstErr
+		}
+		tried[e] = true
+
+		attempt, err := endpointRequest(req, e, ref, len(tried) > 1)
+		if err != nil {
+			p.release(e)
+			closeBody(req)
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return nil, err
+		}
+
+		resp, err := send(attempt)
+		if err != nil {
+			p.release(e)
+			p.failure(e)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if req.Context().Err() != nil || !isRetryable(req) {
+				return nil, firstErr
+			}
+			continue
+		}
+
+		if resp.StatusCode >= 500 {
+			p.failure(e)
+		} else {
+			p.success(e)
+		}
+		resp.Body = &closeHook{ReadCloser: resp.Body, onClose: func() { p.release(e) }}
+		return resp, nil
+	}
+}
+
+// endpointRef returns the url of the request relative to the base url, to be
+// resolved against the endpoint it is sent to. The url is read when the
+// request is sent, so that the changes made after its creation are kept.
+func (c *Client) endpointRef(req *http.Request) (string, bool) {
+	if _, ok := req.Context().Value(endpointRefKey{}).(bool); !ok || c.pool == nil {
+		return "", false
+	}
+	if ref, ok := strings.CutPrefix(req.URL.String(), c.BaseURL.String()); ok {
+		return ref, true
+	}
+	if req.URL.Scheme == c.BaseURL.Scheme && req.URL.Host == c.BaseURL.Host {
+		return req.URL.RequestURI(), true
+	}
+	return "", false
+}
+
+// endpointRequest returns a copy of the request targeting the endpoint.
+func endpointRequest(req *http.Request, e *endpoint, ref string, replay bool) (*http.Request, error) {
+	u, err := e.baseURL.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	attempt := req.Clone(req.Context())
+	attempt.URL = u
+	if req.Host == req.URL.Host {
+		attempt.Host = u.Host
+	}
+	if replay && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("request body can not be replayed")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+	}
+	return attempt, nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package jsonclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointPool(t *testing.T) {
+	type backend struct {
+		server *httptest.Server
+		status int64
+		calls  int64
+	}
+	newBackend := func(t *testing.T, name string) *backend {
+		t.Helper()
+		b := &backend{status: http.StatusOK}
+		b.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/api/health" {
+				w.WriteHeader(int(atomic.LoadInt64(&b.status)))
+				return
+			}
+			atomic.AddInt64(&b.calls, 1)
+			require.Equal(t, "/api/resource", req.URL.Path)
+			w.WriteHeader(int(atomic.LoadInt64(&b.status)))
+			w.Write([]byte(`{"name": "` + name + `"}`))
+		}))
+		t.Cleanup(b.server.Close)
+		return b
+	}
+	type Response struct {
+		Name string `json:"name"`
+	}
+	get := func(t *testing.T, client *Client, method string) (string, error) {
+		t.Helper()
+		req, err := client.NewRequestWithContext(context.Background(), method, "resource", nil)
+		require.NoError(t, err)
+		var v Response
+		_, err = client.Do(req, &v)
+		return v.Name, err
+	}
+
+	t.Run("round robin", func(t *testing.T) {
+		a, b := newBackend(t, "a"), newBackend(t, "b")
+		client, err := New(Options{Endpoints: &EndpointPool{BaseURLs: []string{a.server.URL + "/api", b.server.URL + "/api"}}})
+		require.NoError(t, err)
+		require.Equal(t, a.server.URL+"/api/", client.BaseURL.String())
+
+		var names []string
+		for i := 0; i < 4; i++ {
+			name, err := get(t, client, http.MethodGet)
+			require.NoError(t, err)
+			names = append(names, name)
+		}
+		require.Equal(t, []string{"a", "b", "a", "b"}, names)
+	})
+
+	t.Run("resolves the url at send time", func(t *testing.T) {
+		a, b := newBackend(t, "a"), newBackend(t, "b")
+		client, err := New(Options{Endpoints: &EndpointPool{
+			BaseURLs: []string{a.server.URL + "/api", b.server.URL + "/api"},
+			Strategy: PriorityFailover,
+		}})
+		require.NoError(t, err)
+
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodGet, "resource", nil)
+		require.NoError(t, err)
+		a.server.Close()
+
+		var v Response
+		resp, err := client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, "b", v.Name)
+		require.Equal(t, b.server.URL+"/api/resource", resp.Request.URL.String())
+	})
+
+	t.Run("keeps the url changes made after the creation", func(t *testing.T) {
+		queries := make(chan string, 1)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			queries <- req.URL.Path + "?" + req.URL.RawQuery
+		}))
+		defer s.Close()
+		client, err := New(Options{Endpoints: &EndpointPool{BaseURLs: []string{s.URL + "/api"}}})
+		require.NoError(t, err)
+
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodGet, "pets?limit=1", nil)
+		require.NoError(t, err)
+		query := req.URL.Query()
+		query.Set("limit", "10")
+		query.Set("tag", "dog")
+		req.URL.RawQuery = query.Encode()
+		_, err = client.Do(req, nil)
+		require.NoError(t, err)
+		require.Equal(t, "/api/pets?limit=10&tag=dog", <-queries)
+	})
+
+	t.Run("priority failover with ejection and health checks", func(t *testing.T) {
+		a, b := newBackend(t, "a"), newBackend(t, "b")
+		client, err := New(Options{Endpoints: &EndpointPool{
+			BaseURLs:            []string{a.server.URL + "/api", b.server.URL + "/api"},
+			Strategy:            PriorityFailover,
+			HealthCheckPath:     "health",
+			HealthCheckInterval: 10 * time.Millisecond,
+			MaxFailures:         2,
+		}})
+		require.NoError(t, err)
+
+		name, err := get(t, client, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, "a", name)
+
+		atomic.StoreInt64(&a.status, http.StatusBadGateway)
+		for i := 0; i < 2; i++ {
+			_, err = get(t, client, http.MethodGet)
+			require.ErrorIs(t, err, ErrHTTP)
+		}
+		require.False(t, client.Endpoints()[0].Healthy)
+
+		name, err = get(t, client, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, "b", name)
+
+		atomic.StoreInt64(&a.status, http.StatusOK)
+		require.Eventually(t, func() bool {
+			return client.Endpoints()[0].Healthy
+		}, time.Second, 10*time.Millisecond)
+
+		name, err = get(t, client, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, "a", name)
+		require.Equal(t, []EndpointStatus{
+			{BaseURL: a.server.URL + "/api/", Healthy: true},
+			{BaseURL: b.server.URL + "/api/", Healthy: true},
+		}, client.Endpoints())
+	})
+
+	t.Run("stops the health checks on close", func(t *testing.T) {
+		a, b := newBackend(t, "a"), newBackend(t, "b")
+		client, err := New(Options{Endpoints: &EndpointPool{
+			BaseURLs:            []string{a.server.URL + "/api", b.server.URL + "/api"},
+			Strategy:            PriorityFailover,
+			HealthCheckPath:     "health",
+			HealthCheckInterval: 10 * time.Millisecond,
+			MaxFailures:         1,
+		}})
+		require.NoError(t, err)
+		ticks := make(chan time.Time)
+		client.pool.tick = func(time.Duration) (<-chan time.Time, func()) {
+			return ticks, func() {}
+		}
+
+		atomic.StoreInt64(&a.status, http.StatusBadGateway)
+		_, err = get(t, client, http.MethodGet)
+		require.ErrorIs(t, err, ErrHTTP)
+		require.False(t, client.Endpoints()[0].Healthy)
+		// the health check is waiting for the next tick
+		ticks <- time.Now()
+
+		require.NoError(t, client.Close())
+		atomic.StoreInt64(&a.status, http.StatusOK)
+		select {
+		case ticks <- time.Now():
+			t.Fatal("health check still running after close")
+		default:
+		}
+		require.False(t, client.Endpoints()[0].Healthy)
+
+		name, err := get(t, client, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, "b", name)
+		require.NoError(t, client.Close())
+
+		noPool, err := New(Options{BaseURL: a.server.URL})
+		require.NoError(t, err)
+		require.NoError(t, noPool.Close())
+	})
+
+	t.Run("retries only idempotent requests on transport errors", func(t *testing.T) {
+		a, b := newBackend(t, "a"), newBackend(t, "b")
+		a.server.Close()
+		client, err := New(Options{Endpoints: &EndpointPool{
+			BaseURLs: []string{a.server.URL, b.server.URL},
+			Strategy: PriorityFailover,
+		}})
+		require.NoError(t, err)
+
+		_, err = get(t, client, http.MethodPost)
+		require.Error(t, err)
+		require.Zero(t, atomic.LoadInt64(&b.calls))
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := New(Options{BaseURL: "http://a/", Endpoints: &EndpointPool{BaseURLs: []string{"http://b/"}}})
+		require.EqualError(t, err, "baseURL and endpoints cannot be both set")
+
+		_, err = New(Options{Endpoints: &EndpointPool{}})
+		require.EqualError(t, err, "endpoint pool without base urls")
+
+		_, err = New(Options{Endpoints: &EndpointPool{BaseURLs: []string{"ftp://a/"}}})
+		require.EqualError(t, err, "unsupported scheme: ftp")
+	})
+}
+
+func TestEndpointPoolPick(t *testing.T) {
+	pool, err := newEndpointPool(EndpointPool{
+		BaseURLs: []string{"http://a/", "http://b/", "http://c/"},
+		Strategy: LeastOutstanding,
+	}, http.DefaultClient)
+	require.NoError(t, err)
+	a, b, c := pool.endpoints[0], pool.endpoints[1], pool.endpoints[2]
+
+	require.Equal(t, a, pool.pick(nil, nil))
+	require.Equal(t, b, pool.pick(nil, nil))
+	require.Equal(t, c, pool.pick(nil, nil))
+	pool.release(b)
+	require.Equal(t, b, pool.pick(nil, nil))
+
+	require.Equal(t, c, pool.pick(nil, map[*endpoint]bool{a: true, b: true}))
+	require.Nil(t, pool.pick(nil, map[*endpoint]bool{a: true, b: true, c: true}))
+
+	// ejected endpoints are used only if there are no others
+	b.healthy = false
+	c.healthy = false
+	require.Equal(t, a, pool.pick(nil, nil))
+	require.Equal(t, b, pool.pick(nil, map[*endpoint]bool{a: true}))
+}
@@ -0,0 +1,200 @@
+// Package graphql implements a GraphQL client over HTTP, on top of the
+// jsonclient Client, with typed errors and Automatic Persisted Queries.
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/davidebianchi/go-jsonclient"
+)
+
+const (
+	persistedQueryNotFound     = "PersistedQueryNotFound"
+	persistedQueryNotSupported = "PersistedQueryNotSupported"
+)
+
+// Location struct define a location of a GraphQL error in the query.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error struct define a GraphQL error returned by the server.
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	if len(e.Path) != 0 {
+		parts := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			parts[i] = fmt.Sprint(p)
+		}
+		fmt.Fprintf(&b, " (path %s)", strings.Join(parts, "."))
+	}
+	for _, l := range e.Locations {
+		fmt.Fprintf(&b, " (line %d, column %d)", l.Line, l.Column)
+	}
+	return b.String()
+}
+
+// Code returns the `code` extension of the error, if any.
+func (e *Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// Errors define the GraphQL errors of a response. They are returned also for
+// responses with 200 status code, together with the partial data.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// Request struct define a GraphQL operation.
+type Request struct {
+	Query         string
+	Variables     map[string]interface{}
+	OperationName string
+}
+
+// Options to pass to create a new GraphQL client
+type Options struct {
+	// Path of the GraphQL endpoint, resolved against the base url of the
+	// client.
+	Path string
+	// PersistedQueries enables the Automatic Persisted Queries: the sha256
+	// hash of the query is sent first, and the full query only if the server
+	// does not know it yet.
+	PersistedQueries bool
+}
+
+// Client struct define a GraphQL client.
+type Client struct {
+	client           *jsonclient.Client
+	path             string
+	persistedQueries int32
+}
+
+// New creates a GraphQL client using the json client.
+func New(client *jsonclient.Client, opts Options) *Client {
+	c := &Client{client: client, path: opts.Path}
+	if opts.PersistedQueries {
+		c.persistedQueries = 1
+	}
+	return c
+}
+
+type body struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
+// Do sends the operation, decoding its `data` into data (if not nil). If the
+// response contains GraphQL errors they are returned as Errors, after the
+// decoding of the (partial) data.
+func (c *Client) Do(ctx context.Context, req Request, data interface{}, opts ...jsonclient.RequestOption) error {
+	b := body{
+		Query:         req.Query,
+		Variables:     req.Variables,
+		OperationName: req.OperationName,
+	}
+
+	if atomic.LoadInt32(&c.persistedQueries) == 1 {
+		hash := sha256.Sum256([]byte(req.Query))
+		b.Extensions = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hex.EncodeToString(hash[:]),
+			},
+		}
+		b.Query = ""
+
+		resp, err := c.send(ctx, b, opts)
+		if err != nil {
+			return err
+		}
+		switch {
+		case resp.hasError(persistedQueryNotFound):
+			b.Query = req.Query
+		case resp.hasError(persistedQueryNotSupported):
+			atomic.StoreInt32(&c.persistedQueries, 0)
+			b.Query = req.Query
+			b.Extensions = nil
+		default:
+			return resp.decode(data)
+		}
+	}
+
+	resp, err := c.send(ctx, b, opts)
+	if err != nil {
+		return err
+	}
+	return resp.decode(data)
+}
+
+func (c *Client) send(ctx context.Context, b body, opts []jsonclient.RequestOption) (*response, error) {
+	req, err := c.client.NewRequestWithContext(ctx, http.MethodPost, c.path, b, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp response
+	if _, err := c.client.Do(req, &resp); err != nil {
+		// GraphQL servers could return the errors with a not 2xx status code
+		var httpErr *jsonclient.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Unmarshal(&resp) == nil && len(resp.Errors) != 0 {
+			return &resp, nil
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// hasError reports whether the response has an error with the message or
+// code, as sent by the persisted queries implementations.
+func (r *response) hasError(message string) bool {
+	for _, err := range r.Errors {
+		if err.Message == message || strings.EqualFold(strings.ReplaceAll(err.Code(), "_", ""), message) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *response) decode(data interface{}) error {
+	if data != nil && len(r.Data) != 0 && string(r.Data) != "null" {
+		if err := json.Unmarshal(r.Data, data); err != nil {
+			return err
+		}
+	}
+	if len(r.Errors) != 0 {
+		return r.Errors
+	}
+	return nil
+}
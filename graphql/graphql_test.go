@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/davidebianchi/go-jsonclient"
+	"github.com/stretchr/testify/require"
+)
+
+type serverRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    struct {
+		PersistedQuery *struct {
+			Version    int    `json:"version"`
+			SHA256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+func TestClient(t *testing.T) {
+	var mu sync.Mutex
+	var received []serverRequest
+	persisted := map[string]string{}
+	supportsAPQ := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var r serverRequest
+		json.NewDecoder(req.Body).Decode(&r)
+		received = append(received, r)
+
+		if pq := r.Extensions.PersistedQuery; pq != nil {
+			if !supportsAPQ {
+				w.Write([]byte(`{"errors": [{"message": "PersistedQueryNotSupported"}]}`))
+				return
+			}
+			if r.Query == "" {
+				query, ok := persisted[pq.SHA256Hash]
+				if !ok {
+					w.Write([]byte(`{"errors": [{"message": "PersistedQueryNotFound", "extensions": {"code": "PERSISTED_QUERY_NOT_FOUND"}}]}`))
+					return
+				}
+				r.Query = query
+			} else {
+				hash := sha256.Sum256([]byte(r.Query))
+				persisted[hex.EncodeToString(hash[:])] = r.Query
+			}
+		}
+
+		switch r.Query {
+		case "query User($id: ID!) { user(id: $id) { name } }":
+			w.Write([]byte(`{"data": {"user": {"name": "` + r.Variables["id"].(string) + `"}}}`))
+		case "query Partial { user { name friends } }":
+			w.Write([]byte(`{"data": {"user": {"name": "a", "friends": null}}, "errors": [{"message": "forbidden", "locations": [{"line": 1, "column": 30}], "path": ["user", "friends"], "extensions": {"code": "FORBIDDEN"}}]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"message": "syntax error", "locations": [{"line": 1, "column": 1}]}]}`))
+		}
+	}))
+	defer server.Close()
+
+	reset := func() []serverRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		r := received
+		received = nil
+		return r
+	}
+
+	client, err := jsonclient.New(jsonclient.Options{BaseURL: server.URL})
+	require.NoError(t, err)
+
+	type User struct {
+		User struct {
+			Name    string    `json:"name"`
+			Friends *[]string `json:"friends"`
+		} `json:"user"`
+	}
+	userQuery := Request{
+		Query:         "query User($id: ID!) { user(id: $id) { name } }",
+		Variables:     map[string]interface{}{"id": "42"},
+		OperationName: "User",
+	}
+
+	t.Run("query with variables", func(t *testing.T) {
+		gql := New(client, Options{Path: "graphql"})
+		var data User
+		require.NoError(t, gql.Do(context.Background(), userQuery, &data))
+		require.Equal(t, "42", data.User.Name)
+
+		sent := reset()
+		require.Len(t, sent, 1)
+		require.Equal(t, "User", sent[0].OperationName)
+		require.Nil(t, sent[0].Extensions.PersistedQuery)
+	})
+
+	t.Run("typed errors with partial data", func(t *testing.T) {
+		gql := New(client, Options{Path: "graphql"})
+		var data User
+		err := gql.Do(context.Background(), Request{Query: "query Partial { user { name friends } }"}, &data)
+		var gqlErrs Errors
+		require.True(t, errors.As(err, &gqlErrs))
+		require.Equal(t, Errors{{
+			Message:    "forbidden",
+			Locations:  []Location{{Line: 1, Column: 30}},
+			Path:       []interface{}{"user", "friends"},
+			Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+		}}, gqlErrs)
+		require.Equal(t, "FORBIDDEN", gqlErrs[0].Code())
+		require.EqualError(t, err, "graphql: forbidden (path user.friends) (line 1, column 30)")
+		require.Equal(t, "a", data.User.Name)
+
+		err = gql.Do(context.Background(), Request{Query: "{"}, &data)
+		require.True(t, errors.As(err, &gqlErrs))
+		require.Equal(t, "syntax error", gqlErrs[0].Message)
+		reset()
+	})
+
+	t.Run("automatic persisted queries", func(t *testing.T) {
+		gql := New(client, Options{Path: "graphql", PersistedQueries: true})
+		hash := sha256.Sum256([]byte(userQuery.Query))
+
+		var data User
+		require.NoError(t, gql.Do(context.Background(), userQuery, &data))
+		require.Equal(t, "42", data.User.Name)
+		sent := reset()
+		require.Len(t, sent, 2)
+		require.Empty(t, sent[0].Query)
+		require.Equal(t, hex.EncodeToString(hash[:]), sent[0].Extensions.PersistedQuery.SHA256Hash)
+		require.Equal(t, 1, sent[0].Extensions.PersistedQuery.Version)
+		require.Equal(t, userQuery.Query, sent[1].Query)
+		require.NotNil(t, sent[1].Extensions.PersistedQuery)
+
+		require.NoError(t, gql.Do(context.Background(), userQuery, &data))
+		sent = reset()
+		require.Len(t, sent, 1)
+		require.Empty(t, sent[0].Query)
+	})
+
+	t.Run("falls back when persisted queries are not supported", func(t *testing.T) {
+		mu.Lock()
+		supportsAPQ = false
+		mu.Unlock()
+		gql := New(client, Options{Path: "graphql", PersistedQueries: true})
+
+		var data User
+		require.NoError(t, gql.Do(context.Background(), userQuery, &data))
+		require.Len(t, reset(), 2)
+		require.NoError(t, gql.Do(context.Background(), userQuery, &data))
+		sent := reset()
+		require.Len(t, sent, 1)
+		require.Equal(t, userQuery.Query, sent[0].Query)
+		require.Nil(t, sent[0].Extensions.PersistedQuery)
+	})
+}
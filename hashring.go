@@ -0,0 +1,108 @@
+package jsonclient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	defaultHashReplicas   = 100
+	defaultHashLoadFactor = 1.25
+)
+
+// WithHashKey sets the key used to route the request with the
+// ConsistentHash strategy. It takes precedence over the HashHeader and
+// HashPathParam of the EndpointPool.
+func WithHashKey(key string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.hashKey = &key
+	}
+}
+
+type ringPoint struct {
+	hash     uint64
+	endpoint *endpoint
+}
+
+// hashRing is a consistent hash ring with virtual nodes. Adding or removing
+// an endpoint only remaps the keys of its virtual nodes.
+type hashRing struct {
+	points []ringPoint
+}
+
+func newHashRing(endpoints []*endpoint, replicas int) *hashRing {
+	ring := &hashRing{points: make([]ringPoint, 0, len(endpoints)*replicas)}
+	for _, e := range endpoints {
+		for i := 0; i < replicas; i++ {
+			ring.points = append(ring.points, ringPoint{
+				hash:     hashKey(e.baseURL.String() + "#" + strconv.Itoa(i)),
+				endpoint: e,
+			})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i].hash < ring.points[j].hash })
+	return ring
+}
+
+// lookup walks the ring from the key, returning the first endpoint accepted.
+func (r *hashRing) lookup(key string, accept func(*endpoint) bool) *endpoint {
+	if len(r.points) == 0 {
+		return nil
+	}
+	h := hashKey(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	for i := 0; i < len(r.points); i++ {
+		e := r.points[(start+i)%len(r.points)].endpoint
+		if accept(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+func hashKey(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// requestHashKey returns the key of the request, from WithHashKey, the
+// HashHeader or the HashPathParam template variable.
+func (p *endpointPool) requestHashKey(req *http.Request) (string, bool) {
+	if cfg := requestConfigFrom(req); cfg != nil && cfg.hashKey != nil {
+		return *cfg.hashKey, true
+	}
+	if p.config.HashHeader != "" {
+		if key := req.Header.Get(p.config.HashHeader); key != "" {
+			return key, true
+		}
+	}
+	if p.config.HashPathParam != "" {
+		vars, _ := req.Context().Value(uriTemplateVarsKey{}).(TemplateVars)
+		if value, ok := vars[p.config.HashPathParam]; ok {
+			return fmt.Sprint(value), true
+		}
+	}
+	return "", false
+}
+
+// pickHashed selects the endpoint of the key with bounded loads: an endpoint
+// is skipped if its outstanding requests would exceed LoadFactor times the
+// average. Must be called with the lock held.
+func (p *endpointPool) pickHashed(key string, candidates []*endpoint) *endpoint {
+	allowed := map[*endpoint]bool{}
+	total := 0
+	for _, e := range candidates {
+		allowed[e] = true
+		total += e.outstanding
+	}
+	capacity := int(math.Ceil(p.config.LoadFactor * float64(total+1) / float64(len(candidates))))
+
+	return p.ring.lookup(key, func(e *endpoint) bool {
+		return allowed[e] && e.outstanding < capacity
+	})
+}
@@ -0,0 +1,146 @@
+package jsonclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistentHash(t *testing.T) {
+	var baseURLs []string
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(`{"name": "` + name + `"}`))
+		}))
+		defer s.Close()
+		baseURLs = append(baseURLs, s.URL)
+	}
+
+	client, err := New(Options{Endpoints: &EndpointPool{
+		BaseURLs:      baseURLs,
+		Strategy:      ConsistentHash,
+		HashHeader:    "X-Tenant",
+		HashPathParam: "id",
+	}})
+	require.NoError(t, err)
+
+	type Response struct {
+		Name string `json:"name"`
+	}
+	do := func(t *testing.T, req *http.Request) string {
+		t.Helper()
+		var v Response
+		_, err := client.Do(req, &v)
+		require.NoError(t, err)
+		return v.Name
+	}
+
+	names := map[string]bool{}
+	for i := 0; i < 30; i++ {
+		id := strconv.Itoa(i)
+
+		req, err := client.NewTemplateRequestWithContext(context.Background(), http.MethodGet, "items/{id}", TemplateVars{"id": id}, nil)
+		require.NoError(t, err)
+		byParam := do(t, req)
+
+		req, err = client.NewRequestWithContext(context.Background(), http.MethodGet, "items", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", id)
+		byHeader := do(t, req)
+
+		req, err = client.NewRequestWithContext(context.Background(), http.MethodGet, "other", nil, WithHashKey(id))
+		require.NoError(t, err)
+		byKey := do(t, req)
+
+		require.Equal(t, byParam, byHeader)
+		require.Equal(t, byParam, byKey)
+		names[byParam] = true
+	}
+	require.Len(t, names, 3, "keys should be spread across endpoints")
+}
+
+func TestHashRing(t *testing.T) {
+	newEndpoints := func(t *testing.T, names ...string) []*endpoint {
+		t.Helper()
+		var endpoints []*endpoint
+		for _, name := range names {
+			e, err := newEndpoint("http://" + name + "/")
+			require.NoError(t, err)
+			endpoints = append(endpoints, e)
+		}
+		return endpoints
+	}
+	acceptAll := func(*endpoint) bool { return true }
+	mapping := func(ring *hashRing) map[string]string {
+		m := map[string]string{}
+		for i := 0; i < 2000; i++ {
+			key := strconv.Itoa(i)
+			m[key] = ring.lookup(key, acceptAll).baseURL.Host
+		}
+		return m
+	}
+
+	endpoints := newEndpoints(t, "a", "b", "c", "d")
+	before := mapping(newHashRing(endpoints, defaultHashReplicas))
+
+	t.Run("adding an endpoint moves keys only to it", func(t *testing.T) {
+		after := mapping(newHashRing(append(endpoints, newEndpoints(t, "e")...), defaultHashReplicas))
+		moved := 0
+		for key, host := range after {
+			if host != before[key] {
+				require.Equal(t, "e", host)
+				moved++
+			}
+		}
+		require.InDelta(t, 2000/5, moved, 150)
+	})
+
+	t.Run("removing an endpoint moves only its keys", func(t *testing.T) {
+		after := mapping(newHashRing(endpoints[:3], defaultHashReplicas))
+		for key, host := range after {
+			if before[key] != "d" {
+				require.Equal(t, before[key], host)
+			}
+		}
+	})
+
+	t.Run("bounded load", func(t *testing.T) {
+		pool, err := newEndpointPool(EndpointPool{BaseURLs: []string{"http://a/", "http://b/", "http://c/"}, Strategy: ConsistentHash}, http.DefaultClient)
+		require.NoError(t, err)
+
+		// a hot key is spread when its endpoint is overloaded
+		ctx := context.WithValue(context.Background(), requestConfigKey{}, newRequestConfig([]RequestOption{WithHashKey("hot")}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		counts := map[*endpoint]int{}
+		for i := 0; i < 30; i++ {
+			counts[pool.pick(req, nil)]++
+		}
+		require.Len(t, counts, 3)
+		for _, count := range counts {
+			require.LessOrEqual(t, count, 13)
+		}
+	})
+}
+
+func TestAddRemoveEndpoint(t *testing.T) {
+	client, err := New(Options{Endpoints: &EndpointPool{BaseURLs: []string{"http://a/"}}})
+	require.NoError(t, err)
+
+	require.NoError(t, client.AddEndpoint("http://b"))
+	require.EqualError(t, client.AddEndpoint("http://b/"), "endpoint http://b/ already in the pool")
+	require.Len(t, client.Endpoints(), 2)
+
+	require.NoError(t, client.RemoveEndpoint("http://a/"))
+	require.EqualError(t, client.RemoveEndpoint("http://a/"), "endpoint http://a/ not in the pool")
+	require.EqualError(t, client.RemoveEndpoint("http://b/"), "cannot remove the last endpoint")
+	require.Equal(t, "http://b/", client.Endpoints()[0].BaseURL)
+
+	noPool, err := New(Options{})
+	require.NoError(t, err)
+	require.EqualError(t, noPool.AddEndpoint("http://a/"), "client without endpoint pool")
+}
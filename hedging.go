@@ -0,0 +1,248 @@
+package jsonclient
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHedgingBudget is the default fraction of requests which could be hedged.
+	defaultHedgingBudget = 0.1
+	// latencySamples is the number of latencies kept to compute the p95.
+	latencySamples = 1000
+	// minLatencySamples is the number of latencies needed before hedging
+	// with the observed p95.
+	minLatencySamples = 20
+)
+
+// HedgingPolicy struct define when idempotent requests (GET and HEAD without
+// body) are hedged: if the response has not arrived within the delay, an
+// identical request is sent, and the first response received is used. The
+// other requests are cancelled.
+type HedgingPolicy struct {
+	// Delay before sending each hedged request. If zero, the p95 of the
+	// observed latencies is used, once enough requests are completed.
+	Delay time.Duration
+	// MaxHedges is the maximum number of hedged requests sent in addition to
+	// the original one. Default to 1.
+	MaxHedges int
+	// Budget is the maximum number of hedged requests, as a fraction of the
+	// requests eligible for hedging. Default to 0.1.
+	Budget float64
+}
+
+// HedgingStats struct contains the hedging metrics of a Client.
+type HedgingStats struct {
+	// Requests is the number of requests eligible for hedging.
+	Requests int64
+	// Hedges is the number of hedged requests sent.
+	Hedges int64
+	// HedgeWins is the number of responses received first from a hedged request.
+	HedgeWins int64
+	// BudgetExhausted is the number of hedged requests not sent because of
+	// the budget.
+	BudgetExhausted int64
+}
+
+type hedger struct {
+	policy HedgingPolicy
+
+	mtx       sync.Mutex
+	latencies []time.Duration
+	next      int
+	stats     HedgingStats
+}
+
+func newHedger(policy HedgingPolicy) *hedger {
+	if policy.MaxHedges <= 0 {
+		policy.MaxHedges = 1
+	}
+	if policy.Budget <= 0 {
+		policy.Budget = defaultHedgingBudget
+	}
+	return &hedger{policy: policy}
+}
+
+// HedgingStats returns the hedging metrics. They are zero if the client has
+// no HedgingPolicy.
+func (c *Client) HedgingStats() HedgingStats {
+	if c.hedger == nil {
+		return HedgingStats{}
+	}
+	c.hedger.mtx.Lock()
+	defer c.hedger.mtx.Unlock()
+	return c.hedger.stats
+}
+
+func canHedge(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// delay returns the delay before hedging, or zero if the latency samples are
+// not enough to compute the p95.
+func (h *hedger) delay() time.Duration {
+	if h.policy.Delay > 0 {
+		return h.policy.Delay
+	}
+	h.mtx.Lock()
+	samples := append([]time.Duration(nil), h.latencies...)
+	h.mtx.Unlock()
+	if len(samples) < minLatencySamples {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	index := int(math.Ceil(0.95*float64(len(samples)))) - 1
+	return samples[index]
+}
+
+func (h *hedger) observe(latency time.Duration) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if len(h.latencies) < latencySamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % latencySamples
+}
+
+func (h *hedger) countRequest() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.stats.Requests++
+}
+
+// allowHedge reports whether the budget allows a new hedged request, and
+// counts it.
+func (h *hedger) allowHedge() bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if float64(h.stats.Hedges+1) > h.policy.Budget*float64(h.stats.Requests) {
+		h.stats.BudgetExhausted++
+		return false
+	}
+	h.stats.Hedges++
+	return true
+}
+
+func (h *hedger) countWin() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.stats.HedgeWins++
+}
+
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	attempt int
+	cancel  context.CancelFunc
+}
+
+// do sends the request, hedging it as configured by the policy.
+func (h *hedger) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	h.countRequest()
+
+	ctx := req.Context()
+	results := make(chan hedgeResult, h.policy.MaxHedges+1)
+	var cancels []context.CancelFunc
+	send := func(attempt int) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		attemptReq := req.Clone(attemptCtx)
+		go func() {
+			start := time.Now()
+			resp, err := client.Do(attemptReq)
+			if err == nil {
+				h.observe(time.Since(start))
+			}
+			results <- hedgeResult{resp: resp, err: err, attempt: attempt, cancel: cancel}
+		}()
+	}
+
+	send(0)
+	inflight, hedges := 1, 0
+
+	var timer <-chan time.Time
+	delay := h.delay()
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	var firstErr error
+	for {
+		select {
+		case result := <-results:
+			inflight--
+			if result.err != nil {
+				result.cancel()
+				if firstErr == nil {
+					firstErr = result.err
+				}
+				if inflight == 0 {
+					return nil, firstErr
+				}
+				continue
+			}
+
+			for attempt, cancel := range cancels {
+				if attempt != result.attempt {
+					cancel()
+				}
+			}
+			go discardResults(results, inflight)
+			if result.attempt > 0 {
+				h.countWin()
+			}
+			result.resp.Body = &closeHook{ReadCloser: result.resp.Body, onClose: result.cancel}
+			return result.resp, nil
+		case <-timer:
+			timer = nil
+			if hedges >= h.policy.MaxHedges || !h.allowHedge() {
+				continue
+			}
+			hedges++
+			inflight++
+			send(hedges)
+			if hedges < h.policy.MaxHedges {
+				t := time.NewTimer(delay)
+				defer t.Stop()
+				timer = t.C
+			}
+		}
+	}
+}
+
+// discardResults closes the responses of the cancelled requests.
+func discardResults(results <-chan hedgeResult, count int) {
+	for i := 0; i < count; i++ {
+		result := <-results
+		if result.resp != nil {
+			result.resp.Body.Close()
+		}
+		result.cancel()
+	}
+}
+
+// closeHook calls onClose, once, when the body is closed, e.g. to cancel the
+// request context.
+type closeHook struct {
+	io.ReadCloser
+	onClose func()
+	once    sync.Once
+}
+
+func (c *closeHook) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.onClose)
+	return err
+}
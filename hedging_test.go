@@ -0,0 +1,129 @@
+package jsonclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedging(t *testing.T) {
+	type Response struct {
+		Attempt int64 `json:"attempt"`
+	}
+
+	// the first request of each pair is slow, until cancelled
+	var calls int64
+	var mtx sync.Mutex
+	var cancelled []int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempt := atomic.AddInt64(&calls, 1)
+		if req.Header.Get("X-Slow") == "true" && attempt%2 == 1 {
+			select {
+			case <-req.Context().Done():
+				mtx.Lock()
+				cancelled = append(cancelled, attempt)
+				mtx.Unlock()
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		w.Write([]byte(`{"attempt": ` + strconv.FormatInt(attempt, 10) + `}`))
+	}))
+	defer s.Close()
+
+	newRequest := func(t *testing.T, client *Client, method string, slow bool) *http.Request {
+		t.Helper()
+		atomic.StoreInt64(&calls, 0)
+		req, err := client.NewRequestWithContext(context.Background(), method, "resource", nil)
+		require.NoError(t, err)
+		if slow {
+			req.Header.Set("X-Slow", "true")
+		}
+		return req
+	}
+
+	t.Run("uses the first response and cancels the other", func(t *testing.T) {
+		client, err := New(Options{BaseURL: s.URL, Hedging: &HedgingPolicy{Delay: 20 * time.Millisecond, Budget: 1}})
+		require.NoError(t, err)
+
+		var v Response
+		start := time.Now()
+		resp, err := client.Do(newRequest(t, client, http.MethodGet, true), &v)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, int64(2), v.Attempt)
+		require.Less(t, time.Since(start), 400*time.Millisecond)
+		require.Equal(t, HedgingStats{Requests: 1, Hedges: 1, HedgeWins: 1}, client.HedgingStats())
+
+		require.Eventually(t, func() bool {
+			mtx.Lock()
+			defer mtx.Unlock()
+			return len(cancelled) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("does not hedge fast responses", func(t *testing.T) {
+		client, err := New(Options{BaseURL: s.URL, Hedging: &HedgingPolicy{Delay: time.Second, Budget: 1}})
+		require.NoError(t, err)
+
+		var v Response
+		_, err = client.Do(newRequest(t, client, http.MethodGet, false), &v)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), v.Attempt)
+		require.Equal(t, HedgingStats{Requests: 1}, client.HedgingStats())
+	})
+
+	t.Run("does not hedge not idempotent requests", func(t *testing.T) {
+		client, err := New(Options{BaseURL: s.URL, Hedging: &HedgingPolicy{Delay: time.Millisecond, Budget: 1}})
+		require.NoError(t, err)
+
+		_, err = client.Do(newRequest(t, client, http.MethodPost, false), nil)
+		require.NoError(t, err)
+		require.Equal(t, HedgingStats{}, client.HedgingStats())
+	})
+
+	t.Run("respects the budget", func(t *testing.T) {
+		client, err := New(Options{BaseURL: s.URL, Hedging: &HedgingPolicy{Delay: 10 * time.Millisecond, Budget: 0.5}})
+		require.NoError(t, err)
+
+		_, err = client.Do(newRequest(t, client, http.MethodGet, true), nil)
+		require.NoError(t, err)
+		require.Equal(t, HedgingStats{Requests: 1, BudgetExhausted: 1}, client.HedgingStats())
+
+		_, err = client.Do(newRequest(t, client, http.MethodGet, true), nil)
+		require.NoError(t, err)
+		require.Equal(t, HedgingStats{Requests: 2, Hedges: 1, HedgeWins: 1, BudgetExhausted: 1}, client.HedgingStats())
+	})
+}
+
+func TestHedgerDelay(t *testing.T) {
+	h := newHedger(HedgingPolicy{})
+	require.Equal(t, 1, h.policy.MaxHedges)
+	require.Equal(t, defaultHedgingBudget, h.policy.Budget)
+
+	for i := 1; i < minLatencySamples; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	require.Zero(t, h.delay())
+
+	for i := minLatencySamples; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	require.Equal(t, 95*time.Millisecond, h.delay())
+
+	for i := 0; i < latencySamples; i++ {
+		h.observe(time.Second)
+	}
+	require.Equal(t, time.Second, h.delay())
+	require.Len(t, h.latencies, latencySamples)
+
+	fixed := newHedger(HedgingPolicy{Delay: time.Millisecond})
+	require.Equal(t, time.Millisecond, fixed.delay())
+}
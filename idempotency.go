@@ -0,0 +1,182 @@
+package jsonclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key, as defined
+// by the IETF httpapi Idempotency-Key draft.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	// ErrIdempotencyConflict define a request rejected because another request
+	// with the same idempotency key is still being processed.
+	ErrIdempotencyConflict = errors.New("idempotency key conflict")
+	// ErrIdempotencyKeyMismatch define a request rejected because the
+	// idempotency key was already used with a different payload.
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key reused with a different payload")
+	// ErrInvalidIdempotencyKey define an idempotency key which is not a valid
+	// structured header string.
+	ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+)
+
+// IdempotencyError struct define a response rejecting the idempotency key of
+// the request, with 409 (ErrIdempotencyConflict) or 422
+// (ErrIdempotencyKeyMismatch) status code and a problem details body whose
+// type or title mentions the idempotency key.
+type IdempotencyError struct {
+	Key       string
+	HTTPError *HTTPError
+	Err       error
+}
+
+func (e *IdempotencyError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Err, e.Key, e.HTTPError)
+}
+
+func (e *IdempotencyError) Unwrap() []error {
+	return []error{e.Err, e.HTTPError}
+}
+
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx which sets the idempotency key of
+// the POST and PATCH requests created with it, instead of a generated one.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// IdempotencyKeyFromRequest returns the idempotency key of the request.
+func IdempotencyKeyFromRequest(req *http.Request) (string, bool) {
+	value := req.Header.Get(IdempotencyKeyHeader)
+	if value == "" {
+		return "", false
+	}
+	return unquoteSFString(value), true
+}
+
+// setIdempotencyKey sets the Idempotency-Key header of POST and PATCH
+// requests, if not already set, with the key in the context or, if enabled,
+// a generated one. Since the header is cloned with the request, the same key
+// is sent by every retry attempt.
+func (c *Client) setIdempotencyKey(req *http.Request) error {
+	if req.Method != http.MethodPost && req.Method != http.MethodPatch {
+		return nil
+	}
+	if req.Header.Get(IdempotencyKeyHeader) != "" {
+		return nil
+	}
+
+	key, ok := req.Context().Value(idempotencyKeyKey{}).(string)
+	if !ok {
+		if !c.idempotencyKeys {
+			return nil
+		}
+		var err error
+		if key, err = newIdempotencyKey(); err != nil {
+			return err
+		}
+	}
+	value, err := quoteSFString(key)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(IdempotencyKeyHeader, value)
+	return nil
+}
+
+// idempotencyError converts the HTTPError of a request with an idempotency
+// key to an IdempotencyError, if the server rejected the key. The other 409
+// and 422 responses are returned as HTTPError.
+func idempotencyError(req *http.Request, err error) error {
+	key, ok := IdempotencyKeyFromRequest(req)
+	var httpErr *HTTPError
+	if !ok || !errors.As(err, &httpErr) || !isIdempotencyProblem(httpErr.Raw) {
+		return err
+	}
+	switch httpErr.StatusCode {
+	case http.StatusConflict:
+		return &IdempotencyError{Key: key, HTTPError: httpErr, Err: ErrIdempotencyConflict}
+	case http.StatusUnprocessableEntity:
+		return &IdempotencyError{Key: key, HTTPError: httpErr, Err: ErrIdempotencyKeyMismatch}
+	}
+	return err
+}
+
+// problemDetails struct define the fields of a problem details (RFC 9457)
+// response body used to recognize the idempotency errors.
+type problemDetails struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+// isIdempotencyProblem reports whether the body is a problem details document
+// whose type or title is about the idempotency key, as the ones in the
+// examples of the draft.
+func isIdempotencyProblem(body []byte) bool {
+	var problem problemDetails
+	if err := json.Unmarshal(body, &problem); err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(problem.Type), "idempotency") ||
+		strings.Contains(strings.ToLower(problem.Title), "idempotency")
+}
+
+// newIdempotencyKey generates a random (version 4) UUID.
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// quoteSFString serializes the key as a structured field string (RFC 8941).
+func quoteSFString(s string) (string, error) {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return "", ErrInvalidIdempotencyKey
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
+
+// unquoteSFString parses a structured field string, returning the value as
+// is if it is not quoted.
+func unquoteSFString(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// isRetryable reports whether the request could be safely sent again: its
+// method is idempotent or it has an idempotency key.
+func isRetryable(req *http.Request) bool {
+	return isIdempotent(req.Method) || req.Header.Get(IdempotencyKeyHeader) != ""
+}
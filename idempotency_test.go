@@ -0,0 +1,149 @@
+package jsonclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	status := http.StatusOK
+	body := `{"title": "error"}`
+	failures := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, req.Header.Get(IdempotencyKeyHeader))
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	reset := func(s, f int) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = nil
+		status = s
+		body = `{"title": "error"}`
+		failures = f
+	}
+	setBody := func(b string) {
+		mu.Lock()
+		defer mu.Unlock()
+		body = b
+	}
+	sentKeys := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, keys...)
+	}
+
+	client, err := New(Options{
+		BaseURL:         server.URL,
+		IdempotencyKeys: true,
+	})
+	require.NoError(t, err)
+
+	t.Run("generates a key for unsafe methods, reused by the retries", func(t *testing.T) {
+		reset(http.StatusOK, 2)
+		req, err := client.NewRequest(http.MethodPost, "charges", map[string]int{"amount": 1}, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.NoError(t, err)
+
+		sent := sentKeys()
+		require.Len(t, sent, 3)
+		require.Regexp(t, regexp.MustCompile(`^"[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"$`), sent[0])
+		require.Equal(t, sent[0], sent[1])
+		require.Equal(t, sent[0], sent[2])
+
+		other, err := client.NewRequest(http.MethodPatch, "charges/1", map[string]int{"amount": 1})
+		require.NoError(t, err)
+		require.NotEqual(t, sent[0], other.Header.Get(IdempotencyKeyHeader))
+
+		get, err := client.NewRequest(http.MethodGet, "charges", nil)
+		require.NoError(t, err)
+		require.Empty(t, get.Header.Get(IdempotencyKeyHeader))
+	})
+
+	t.Run("takes the key from the context or the headers", func(t *testing.T) {
+		ctx := WithIdempotencyKey(context.Background(), `my "key"`)
+		req, err := client.NewRequestWithContext(ctx, http.MethodPost, "charges", nil)
+		require.NoError(t, err)
+		require.Equal(t, `"my \"key\""`, req.Header.Get(IdempotencyKeyHeader))
+		key, ok := IdempotencyKeyFromRequest(req)
+		require.True(t, ok)
+		require.Equal(t, `my "key"`, key)
+
+		req, err = client.NewRequest(http.MethodPost, "charges", nil, WithHeader(IdempotencyKeyHeader, `"custom"`))
+		require.NoError(t, err)
+		require.Equal(t, `"custom"`, req.Header.Get(IdempotencyKeyHeader))
+
+		_, err = client.NewRequestWithContext(WithIdempotencyKey(context.Background(), "a\nb"), http.MethodPost, "charges", nil)
+		require.ErrorIs(t, err, ErrInvalidIdempotencyKey)
+
+		noKeys, err := New(Options{BaseURL: server.URL})
+		require.NoError(t, err)
+		req, err = noKeys.NewRequest(http.MethodPost, "charges", nil)
+		require.NoError(t, err)
+		require.Empty(t, req.Header.Get(IdempotencyKeyHeader))
+		req, err = noKeys.NewRequestWithContext(ctx, http.MethodPost, "charges", nil)
+		require.NoError(t, err)
+		require.NotEmpty(t, req.Header.Get(IdempotencyKeyHeader))
+	})
+
+	t.Run("typed conflict and mismatch errors", func(t *testing.T) {
+		problems := map[int]string{
+			http.StatusConflict:            `{"type": "https://example.com/idempotency", "title": "A request is outstanding for this Idempotency-Key"}`,
+			http.StatusUnprocessableEntity: `{"type": "https://example.com/errors", "title": "Idempotency-Key is already used"}`,
+		}
+		for status, expected := range map[int]error{
+			http.StatusConflict:            ErrIdempotencyConflict,
+			http.StatusUnprocessableEntity: ErrIdempotencyKeyMismatch,
+		} {
+			reset(status, 0)
+			setBody(problems[status])
+			req, err := client.NewRequestWithContext(WithIdempotencyKey(context.Background(), "k"), http.MethodPost, "charges", nil)
+			require.NoError(t, err)
+			_, err = client.Do(req, nil)
+
+			var idempotencyErr *IdempotencyError
+			require.True(t, errors.As(err, &idempotencyErr))
+			require.ErrorIs(t, err, expected)
+			require.ErrorIs(t, err, ErrHTTP)
+			require.Equal(t, "k", idempotencyErr.Key)
+			require.Equal(t, status, idempotencyErr.HTTPError.StatusCode)
+			require.Equal(t, problems[status], string(idempotencyErr.HTTPError.Raw))
+
+			// other conflicts and validation errors are not about the key
+			reset(status, 0)
+			req, err = client.NewRequestWithContext(WithIdempotencyKey(context.Background(), "k"), http.MethodPost, "charges", nil)
+			require.NoError(t, err)
+			_, err = client.Do(req, nil)
+			require.False(t, errors.As(err, &idempotencyErr))
+			require.ErrorIs(t, err, ErrHTTP)
+		}
+
+		reset(http.StatusConflict, 0)
+		req, err := client.NewRequest(http.MethodPut, "charges/1", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		var idempotencyErr *IdempotencyError
+		require.False(t, errors.As(err, &idempotencyErr))
+		require.ErrorIs(t, err, ErrHTTP)
+	})
+}
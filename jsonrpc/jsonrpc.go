@@ -0,0 +1,250 @@
+// Package jsonrpc implements a JSON-RPC 2.0 client over HTTP, on top of the
+// jsonclient Client. The calls are sent with POST requests to a path relative
+// to the client base url, with the client headers, options and error handling.
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/davidebianchi/go-jsonclient"
+)
+
+const version = "2.0"
+
+// Error codes defined by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var (
+	// ErrInvalidResponse define a response which is not a valid JSON-RPC 2.0
+	// response for the call.
+	ErrInvalidResponse = errors.New("invalid jsonrpc response")
+	// ErrMissingResponse define a batch call without a response.
+	ErrMissingResponse = errors.New("missing jsonrpc response")
+)
+
+// Error struct define a JSON-RPC error object returned by the server.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Data) != 0 {
+		return fmt.Sprintf("jsonrpc error %d: %s: %s", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// Unmarshal Error data content
+func (e *Error) Unmarshal(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Client struct define a JSON-RPC 2.0 client.
+type Client struct {
+	client *jsonclient.Client
+	path   string
+	nextID int64
+}
+
+// New creates a JSON-RPC client sending the calls to path, resolved against
+// the base url of client.
+func New(client *jsonclient.Client, path string) *Client {
+	return &Client{client: client, path: path}
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      *int64      `json:"id,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+}
+
+// Call calls the method with params, decoding the result into result (if not
+// nil). params must be nil, or encoded as a json object or array.
+// If the server returns an error object, it is returned as *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}, opts ...jsonclient.RequestOption) error {
+	id := c.newID()
+	req, err := c.client.NewRequestWithContext(ctx, http.MethodPost, c.path, request{
+		JSONRPC: version,
+		Method:  method,
+		Params:  params,
+		ID:      &id,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	var resp response
+	if _, err := c.client.Do(req, &resp); err != nil {
+		return errorFromHTTP(err)
+	}
+	// errors of requests which could not be parsed, e.g. Parse error and
+	// Invalid Request, have a null id
+	matches := idOf(resp.ID) == strconv.FormatInt(id, 10)
+	if resp.Error != nil && (matches || isNullID(resp.ID)) {
+		return resp.decode(result)
+	}
+	if !matches {
+		return fmt.Errorf("%w: id %s, expected %d", ErrInvalidResponse, resp.ID, id)
+	}
+	return resp.decode(result)
+}
+
+// Notify sends a notification of the method with params, without waiting for
+// a result.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}, opts ...jsonclient.RequestOption) error {
+	req, err := c.client.NewRequestWithContext(ctx, http.MethodPost, c.path, request{
+		JSONRPC: version,
+		Method:  method,
+		Params:  params,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Do(req, nil)
+	return errorFromHTTP(err)
+}
+
+// BatchCall struct define a call of a batch. Notifications have no response.
+// After the batch is sent, Err contains the error of the call (if any).
+type BatchCall struct {
+	Method       string
+	Params       interface{}
+	Result       interface{}
+	Notification bool
+
+	Err error
+}
+
+// Batch sends the calls in a single request. The responses are matched to
+// the calls by id, regardless of their order, and the error of each call is
+// set in its Err field. The returned error is about the whole batch, e.g.
+// transport or HTTP errors.
+func (c *Client) Batch(ctx context.Context, calls []*BatchCall, opts ...jsonclient.RequestOption) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	requests := make([]request, len(calls))
+	pending := map[string]*BatchCall{}
+	for i, call := range calls {
+		call.Err = nil
+		requests[i] = request{JSONRPC: version, Method: call.Method, Params: call.Params}
+		if !call.Notification {
+			id := c.newID()
+			requests[i].ID = &id
+			pending[strconv.FormatInt(id, 10)] = call
+		}
+	}
+
+	req, err := c.client.NewRequestWithContext(ctx, http.MethodPost, c.path, requests, opts...)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		_, err = c.client.Do(req, nil)
+		return errorFromHTTP(err)
+	}
+
+	var raw json.RawMessage
+	if _, err := c.client.Do(req, &raw); err != nil {
+		return errorFromHTTP(err)
+	}
+
+	var responses []response
+	raw = bytes.TrimSpace(raw)
+	if len(raw) != 0 && raw[0] == '{' {
+		// the server could not process the batch (e.g. invalid json), and
+		// returned a single error
+		var resp response
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return err
+		}
+		if resp.Error == nil {
+			return fmt.Errorf("%w: expected an array of responses", ErrInvalidResponse)
+		}
+		return resp.Error
+	}
+	if err := json.Unmarshal(raw, &responses); err != nil {
+		return err
+	}
+
+	for _, resp := range responses {
+		call, ok := pending[idOf(resp.ID)]
+		if !ok {
+			continue
+		}
+		delete(pending, idOf(resp.ID))
+		call.Err = resp.decode(call.Result)
+	}
+	for _, call := range pending {
+		call.Err = ErrMissingResponse
+	}
+	return nil
+}
+
+func (c *Client) newID() int64 {
+	return atomic.AddInt64(&c.nextID, 1)
+}
+
+func (r response) decode(result interface{}) error {
+	if r.JSONRPC != version {
+		return fmt.Errorf("%w: version %q", ErrInvalidResponse, r.JSONRPC)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if result == nil || len(r.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Result, result)
+}
+
+// idOf returns the id in a comparable form, accepting ids encoded as strings.
+func idOf(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(raw))
+}
+
+func isNullID(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+// errorFromHTTP returns the JSON-RPC error object of an HTTP error response,
+// if any, or the error itself.
+func errorFromHTTP(err error) error {
+	var httpErr *jsonclient.HTTPError
+	if !errors.As(err, &httpErr) {
+		return err
+	}
+	var resp response
+	if httpErr.Unmarshal(&resp) == nil && resp.Error != nil {
+		return resp.Error
+	}
+	return err
+}
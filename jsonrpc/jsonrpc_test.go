@@ -0,0 +1,188 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidebianchi/go-jsonclient"
+	"github.com/stretchr/testify/require"
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func handle(req rpcRequest) map[string]interface{} {
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "sum":
+		var params []int
+		json.Unmarshal(req.Params, &params)
+		sum := 0
+		for _, p := range params {
+			sum += p
+		}
+		resp["result"] = sum
+	case "fail":
+		resp["error"] = map[string]interface{}{"code": CodeInvalidParams, "message": "invalid params", "data": map[string]string{"field": "a"}}
+	default:
+		resp["error"] = map[string]interface{}{"code": CodeMethodNotFound, "message": "method not found"}
+	}
+	return resp
+}
+
+func TestClient(t *testing.T) {
+	var notified []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/api/rpc", req.URL.Path)
+		require.Equal(t, http.MethodPost, req.Method)
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+
+		if body[0] == '[' {
+			var reqs []rpcRequest
+			if err := json.Unmarshal(body, &reqs); err != nil || len(reqs) == 0 {
+				json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": map[string]interface{}{"code": CodeInvalidRequest, "message": "invalid request"}})
+				return
+			}
+			var resps []interface{}
+			// responses in reverse order, skipping notifications
+			for i := len(reqs) - 1; i >= 0; i-- {
+				if reqs[i].ID == nil {
+					notified = append(notified, reqs[i].Method)
+					continue
+				}
+				if reqs[i].Method != "lost" {
+					resps = append(resps, handle(reqs[i]))
+				}
+			}
+			if len(resps) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			json.NewEncoder(w).Encode(resps)
+			return
+		}
+
+		var r rpcRequest
+		require.NoError(t, json.Unmarshal(body, &r))
+		require.Equal(t, "2.0", r.JSONRPC)
+		if r.ID == nil {
+			notified = append(notified, r.Method)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method == "crash" {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": r.ID, "error": map[string]interface{}{"code": CodeInternalError, "message": "internal error"}})
+			return
+		}
+		if r.Method == "wrong id" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": -1, "result": 1})
+			return
+		}
+		if r.Method == "unparsable" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": map[string]interface{}{"code": CodeParseError, "message": "parse error"}})
+			return
+		}
+		if r.Method == "unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(handle(r))
+	}))
+	defer server.Close()
+
+	client, err := jsonclient.New(jsonclient.Options{
+		BaseURL: server.URL + "/api/",
+		Headers: jsonclient.Headers{"Authorization": "Bearer token"},
+	})
+	require.NoError(t, err)
+	rpc := New(client, "rpc")
+
+	t.Run("call", func(t *testing.T) {
+		var sum int
+		require.NoError(t, rpc.Call(context.Background(), "sum", []int{1, 2, 3}, &sum))
+		require.Equal(t, 6, sum)
+	})
+
+	t.Run("error object", func(t *testing.T) {
+		err := rpc.Call(context.Background(), "fail", nil, nil)
+		var rpcErr *Error
+		require.True(t, errors.As(err, &rpcErr))
+		require.Equal(t, CodeInvalidParams, rpcErr.Code)
+		require.EqualError(t, err, `jsonrpc error -32602: invalid params: {"field":"a"}`)
+		var data map[string]string
+		require.NoError(t, rpcErr.Unmarshal(&data))
+		require.Equal(t, "a", data["field"])
+
+		err = rpc.Call(context.Background(), "crash", nil, nil)
+		require.True(t, errors.As(err, &rpcErr))
+		require.Equal(t, CodeInternalError, rpcErr.Code)
+
+		err = rpc.Call(context.Background(), "unparsable", nil, nil)
+		require.True(t, errors.As(err, &rpcErr))
+		require.Equal(t, CodeParseError, rpcErr.Code)
+		require.NotErrorIs(t, err, ErrInvalidResponse)
+
+		err = rpc.Call(context.Background(), "wrong id", nil, nil)
+		require.ErrorIs(t, err, ErrInvalidResponse)
+
+		err = rpc.Call(context.Background(), "unavailable", nil, nil)
+		require.ErrorIs(t, err, jsonclient.ErrHTTP)
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		notified = nil
+		require.NoError(t, rpc.Notify(context.Background(), "log", map[string]string{"msg": "a"}))
+		require.Equal(t, []string{"log"}, notified)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		notified = nil
+		var a, b int
+		calls := []*BatchCall{
+			{Method: "sum", Params: []int{1, 2}, Result: &a},
+			{Method: "log", Notification: true},
+			{Method: "sum", Params: []int{3, 4}, Result: &b},
+			{Method: "unknown"},
+			{Method: "lost"},
+		}
+		require.NoError(t, rpc.Batch(context.Background(), calls))
+		require.Equal(t, 3, a)
+		require.Equal(t, 7, b)
+		require.NoError(t, calls[0].Err)
+		require.NoError(t, calls[1].Err)
+		require.NoError(t, calls[2].Err)
+		var rpcErr *Error
+		require.True(t, errors.As(calls[3].Err, &rpcErr))
+		require.Equal(t, CodeMethodNotFound, rpcErr.Code)
+		require.ErrorIs(t, calls[4].Err, ErrMissingResponse)
+		require.Equal(t, []string{"log"}, notified)
+
+		notified = nil
+		require.NoError(t, rpc.Batch(context.Background(), []*BatchCall{
+			{Method: "a", Notification: true},
+			{Method: "b", Notification: true},
+		}))
+		require.Equal(t, []string{"b", "a"}, notified)
+	})
+
+	t.Run("request options", func(t *testing.T) {
+		err := rpc.Call(context.Background(), "sum", nil, nil, jsonclient.WithBearerToken("other"))
+		var httpErr *jsonclient.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		require.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+	})
+}
@@ -0,0 +1,682 @@
+package jsonclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxSchemaDepth = 256
+
+// Schema is a compiled JSON Schema. The core keywords of the draft 2020-12 are
+// supported: type, enum, const, the numeric, string, array and object
+// validation keywords, allOf, anyOf, oneOf, not, if/then/else,
+// dependentSchemas, $defs and $ref to the same document (json pointers,
+// $anchor and $id, resolved against the base URI set by the enclosing $id).
+// The format keyword is considered only an annotation, and unevaluatedItems
+// and unevaluatedProperties are not supported.
+type Schema struct {
+	root    interface{}
+	regexps map[string]*regexp.Regexp
+	refs    map[string]interface{}
+	targets map[resolvedRef]interface{}
+	pending []resolvedRef
+}
+
+// SchemaViolation describes a single validation failure.
+// InstancePath is the JSON pointer of the failing value in the validated
+// document, SchemaPath the JSON pointer of the failing keyword in the schema.
+type SchemaViolation struct {
+	InstancePath string
+	SchemaPath   string
+	Message      string
+}
+
+func (v SchemaViolation) String() string {
+	path := v.InstancePath
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s", path, v.Message)
+}
+
+// CompileSchema parses and compiles a JSON Schema document.
+func CompileSchema(data []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("json schema: %w", err)
+	}
+
+	s := &Schema{
+		root:    root,
+		regexps: map[string]*regexp.Regexp{},
+		refs:    map[string]interface{}{"": root},
+		targets: map[resolvedRef]interface{}{},
+	}
+	if err := s.compile(root, "", ""); err != nil {
+		return nil, err
+	}
+	// the targets of the refs are compiled too, as they could be reached only
+	// through keywords not known by the compiler (e.g. definitions)
+	for len(s.pending) != 0 {
+		ref := s.pending[0]
+		s.pending = s.pending[1:]
+		if _, ok := s.targets[ref]; ok {
+			continue
+		}
+		target, err := s.resolveRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		s.targets[ref] = target
+		base, _, _ := strings.Cut(string(ref), "#")
+		if err := s.compile(target, string(ref), base); err != nil {
+			return nil, err
+		}
+	}
+	s.pending = nil
+	return s, nil
+}
+
+// MustCompileSchema is like CompileSchema but panics if the schema is not valid.
+func MustCompileSchema(data []byte) *Schema {
+	s, err := CompileSchema(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// resolvedRef is a $ref resolved against the base URI of its schema. It
+// replaces the $ref value once compiled.
+type resolvedRef string
+
+// compile compiles the schema and its subschemas. base is the URI of the
+// schema resource, set by the $id keyword, used to resolve $id and $ref.
+func (s *Schema) compile(node interface{}, path, base string) error {
+	switch n := node.(type) {
+	case bool:
+		return nil
+	case map[string]interface{}:
+		if id, ok := n["$id"].(string); ok {
+			resolved, err := resolveURI(base, id)
+			if err != nil {
+				return fmt.Errorf("json schema: invalid $id at %q: %w", path, err)
+			}
+			base, _, _ = strings.Cut(resolved, "#")
+			s.refs[base] = n
+		}
+		if anchor, ok := n["$anchor"].(string); ok {
+			s.refs[base+"#"+anchor] = n
+		}
+		switch ref := n["$ref"].(type) {
+		case nil, resolvedRef:
+		case string:
+			resolved, err := resolveURI(base, ref)
+			if err != nil {
+				return fmt.Errorf("json schema: invalid $ref at %q: %w", path, err)
+			}
+			n["$ref"] = resolvedRef(resolved)
+			s.pending = append(s.pending, resolvedRef(resolved))
+		default:
+			return fmt.Errorf("json schema: $ref at %q must be a string", path)
+		}
+		if pattern, ok := n["pattern"].(string); ok {
+			if err := s.compileRegexp(pattern, path+"/pattern"); err != nil {
+				return err
+			}
+		}
+		if props, ok := n["patternProperties"].(map[string]interface{}); ok {
+			for pattern := range props {
+				if err := s.compileRegexp(pattern, path+"/patternProperties"); err != nil {
+					return err
+				}
+			}
+		}
+		for _, key := range sortedKeys(n) {
+			if key == "enum" || key == "const" {
+				continue
+			}
+			if err := s.compileSubschemas(key, n[key], path+"/"+escapeJSONPointer(key), base); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("json schema: schema at %q must be an object or a boolean", path)
+	}
+}
+
+func (s *Schema) compileSubschemas(keyword string, value interface{}, path, base string) error {
+	switch keyword {
+	case "items", "contains", "additionalProperties", "propertyNames", "not", "if", "then", "else":
+		return s.compile(value, path, base)
+	case "prefixItems", "allOf", "anyOf", "oneOf":
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("json schema: %q must be an array", path)
+		}
+		for i, item := range list {
+			if err := s.compile(item, path+"/"+strconv.Itoa(i), base); err != nil {
+				return err
+			}
+		}
+	case "properties", "patternProperties", "$defs", "dependentSchemas":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("json schema: %q must be an object", path)
+		}
+		for _, key := range sortedKeys(m) {
+			if err := s.compile(m[key], path+"/"+escapeJSONPointer(key), base); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compileRegexp(pattern, path string) error {
+	if _, ok := s.regexps[pattern]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("json schema: invalid pattern at %q: %w", path, err)
+	}
+	s.regexps[pattern] = re
+	return nil
+}
+
+// resolveURI resolves the uri reference against the base URI, if any.
+func resolveURI(base, ref string) (string, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if base == "" {
+		return refURL.String(), nil
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+// resolveRef returns the schema of the resolved ref: the resource with the
+// $id, the $anchor or the json pointer from the resource.
+func (s *Schema) resolveRef(ref resolvedRef) (interface{}, error) {
+	refURL, err := url.Parse(string(ref))
+	if err != nil {
+		return nil, fmt.Errorf("json schema: unresolvable $ref %q", ref)
+	}
+	pointer := refURL.Fragment
+	refURL.Fragment, refURL.RawFragment = "", ""
+	base := refURL.String()
+
+	if node, ok := s.refs[base+"#"+pointer]; ok {
+		return node, nil
+	}
+	node, ok := s.refs[base]
+	if !ok {
+		return nil, fmt.Errorf("json schema: unsupported $ref %q", ref)
+	}
+	if pointer == "" {
+		return node, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("json schema: unresolvable $ref %q", ref)
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			next, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("json schema: unresolvable $ref %q", ref)
+			}
+			node = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("json schema: unresolvable $ref %q", ref)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("json schema: unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// Validate validates v, using its JSON representation, against the schema.
+func (s *Schema) Validate(v interface{}) ([]SchemaViolation, error) {
+	instance, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.validateInstance(instance), nil
+}
+
+// ValidateJSON validates a JSON document against the schema.
+func (s *Schema) ValidateJSON(data []byte) ([]SchemaViolation, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var instance interface{}
+	if err := dec.Decode(&instance); err != nil {
+		return nil, err
+	}
+	return s.validateInstance(instance), nil
+}
+
+func (s *Schema) validateInstance(instance interface{}) []SchemaViolation {
+	var violations []SchemaViolation
+	s.validate(&violations, s.root, instance, "", "", 0)
+	return violations
+}
+
+func (s *Schema) isValid(node, instance interface{}, depth int) bool {
+	var violations []SchemaViolation
+	s.validate(&violations, node, instance, "", "", depth)
+	return len(violations) == 0
+}
+
+func (s *Schema) validate(out *[]SchemaViolation, node, instance interface{}, instancePath, schemaPath string, depth int) {
+	fail := func(keyword, format string, args ...interface{}) {
+		*out = append(*out, SchemaViolation{
+			InstancePath: instancePath,
+			SchemaPath:   schemaPath + "/" + keyword,
+			Message:      fmt.Sprintf(format, args...),
+		})
+	}
+
+	if depth > maxSchemaDepth {
+		fail("$ref", "maximum schema depth exceeded")
+		return
+	}
+
+	var schema map[string]interface{}
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			*out = append(*out, SchemaViolation{InstancePath: instancePath, SchemaPath: schemaPath, Message: "false schema does not allow any value"})
+		}
+		return
+	case map[string]interface{}:
+		schema = n
+	default:
+		return
+	}
+
+	if ref, ok := schema["$ref"].(resolvedRef); ok {
+		if target, ok := s.targets[ref]; ok {
+			s.validate(out, target, instance, instancePath, schemaPath+"/$ref", depth+1)
+		}
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, instance) {
+		fail("type", "expected type %s, got %s", formatSchemaType(t), jsonTypeOf(instance))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if jsonEqual(item, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "value is not one of the allowed values")
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, instance) {
+		fail("const", "value does not match the constant value")
+	}
+
+	switch inst := instance.(type) {
+	case json.Number:
+		s.validateNumber(fail, schema, inst)
+	case string:
+		s.validateString(fail, schema, inst)
+	case []interface{}:
+		s.validateArray(out, fail, schema, inst, instancePath, schemaPath, depth)
+	case map[string]interface{}:
+		s.validateObject(out, fail, schema, inst, instancePath, schemaPath, depth)
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for i, sub := range allOf {
+			s.validate(out, sub, instance, instancePath, schemaPath+"/allOf/"+strconv.Itoa(i), depth+1)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		valid := false
+		for _, sub := range anyOf {
+			if s.isValid(sub, instance, depth+1) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			fail("anyOf", "value does not match any of the schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if s.isValid(sub, instance, depth+1) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("oneOf", "value must match exactly one schema, but matches %d", matches)
+		}
+	}
+	if not, ok := schema["not"]; ok && s.isValid(not, instance, depth+1) {
+		fail("not", "value must not match the schema")
+	}
+	if ifSchema, ok := schema["if"]; ok {
+		if s.isValid(ifSchema, instance, depth+1) {
+			if then, ok := schema["then"]; ok {
+				s.validate(out, then, instance, instancePath, schemaPath+"/then", depth+1)
+			}
+		} else if elseSchema, ok := schema["else"]; ok {
+			s.validate(out, elseSchema, instance, instancePath, schemaPath+"/else", depth+1)
+		}
+	}
+}
+
+type failFunc func(keyword, format string, args ...interface{})
+
+func (s *Schema) validateNumber(fail failFunc, schema map[string]interface{}, n json.Number) {
+	value, ok := toRat(n)
+	if !ok {
+		return
+	}
+	if limit, ok := toRat(schema["minimum"]); ok && value.Cmp(limit) < 0 {
+		fail("minimum", "must be >= %s", limit.RatString())
+	}
+	if limit, ok := toRat(schema["maximum"]); ok && value.Cmp(limit) > 0 {
+		fail("maximum", "must be <= %s", limit.RatString())
+	}
+	if limit, ok := toRat(schema["exclusiveMinimum"]); ok && value.Cmp(limit) <= 0 {
+		fail("exclusiveMinimum", "must be > %s", limit.RatString())
+	}
+	if limit, ok := toRat(schema["exclusiveMaximum"]); ok && value.Cmp(limit) >= 0 {
+		fail("exclusiveMaximum", "must be < %s", limit.RatString())
+	}
+	if divisor, ok := toRat(schema["multipleOf"]); ok && divisor.Sign() > 0 {
+		if !new(big.Rat).Quo(value, divisor).IsInt() {
+			fail("multipleOf", "must be a multiple of %s", divisor.RatString())
+		}
+	}
+}
+
+func (s *Schema) validateString(fail failFunc, schema map[string]interface{}, str string) {
+	length := utf8.RuneCountInString(str)
+	if limit, ok := toInt(schema["minLength"]); ok && length < limit {
+		fail("minLength", "length must be >= %d, got %d", limit, length)
+	}
+	if limit, ok := toInt(schema["maxLength"]); ok && length > limit {
+		fail("maxLength", "length must be <= %d, got %d", limit, length)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re := s.regexps[pattern]; re != nil && !re.MatchString(str) {
+			fail("pattern", "does not match pattern %q", pattern)
+		}
+	}
+}
+
+func (s *Schema) validateArray(out *[]SchemaViolation, fail failFunc, schema map[string]interface{}, arr []interface{}, instancePath, schemaPath string, depth int) {
+	if limit, ok := toInt(schema["minItems"]); ok && len(arr) < limit {
+		fail("minItems", "must have at least %d items, got %d", limit, len(arr))
+	}
+	if limit, ok := toInt(schema["maxItems"]); ok && len(arr) > limit {
+		fail("maxItems", "must have at most %d items, got %d", limit, len(arr))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	outer:
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					fail("uniqueItems", "items at index %d and %d are equal", i, j)
+					break outer
+				}
+			}
+		}
+	}
+
+	prefixLen := 0
+	if prefixItems, ok := schema["prefixItems"].([]interface{}); ok {
+		for i, sub := range prefixItems {
+			if i >= len(arr) {
+				break
+			}
+			s.validate(out, sub, arr[i], instancePath+"/"+strconv.Itoa(i), schemaPath+"/prefixItems/"+strconv.Itoa(i), depth+1)
+		}
+		prefixLen = len(prefixItems)
+	}
+	if items, ok := schema["items"]; ok {
+		for i := prefixLen; i < len(arr); i++ {
+			s.validate(out, items, arr[i], instancePath+"/"+strconv.Itoa(i), schemaPath+"/items", depth+1)
+		}
+	}
+
+	if contains, ok := schema["contains"]; ok {
+		matches := 0
+		for _, item := range arr {
+			if s.isValid(contains, item, depth+1) {
+				matches++
+			}
+		}
+		minContains, hasMin := toInt(schema["minContains"])
+		if !hasMin {
+			minContains = 1
+		}
+		if matches < minContains {
+			keyword := "contains"
+			if hasMin {
+				keyword = "minContains"
+			}
+			fail(keyword, "must contain at least %d matching items, got %d", minContains, matches)
+		}
+		if maxContains, ok := toInt(schema["maxContains"]); ok && matches > maxContains {
+			fail("maxContains", "must contain at most %d matching items, got %d", maxContains, matches)
+		}
+	}
+}
+
+func (s *Schema) validateObject(out *[]SchemaViolation, fail failFunc, schema map[string]interface{}, obj map[string]interface{}, instancePath, schemaPath string, depth int) {
+	if limit, ok := toInt(schema["minProperties"]); ok && len(obj) < limit {
+		fail("minProperties", "must have at least %d properties, got %d", limit, len(obj))
+	}
+	if limit, ok := toInt(schema["maxProperties"]); ok && len(obj) > limit {
+		fail("maxProperties", "must have at most %d properties, got %d", limit, len(obj))
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := obj[name]; !exists {
+					fail("required", "missing required property %q", name)
+				}
+			}
+		}
+	}
+	if dependentRequired, ok := schema["dependentRequired"].(map[string]interface{}); ok {
+		for _, key := range sortedKeys(dependentRequired) {
+			if _, exists := obj[key]; !exists {
+				continue
+			}
+			deps, _ := dependentRequired[key].([]interface{})
+			for _, d := range deps {
+				if name, ok := d.(string); ok {
+					if _, exists := obj[name]; !exists {
+						fail("dependentRequired", "property %q is required when %q is present", name, key)
+					}
+				}
+			}
+		}
+	}
+	if dependentSchemas, ok := schema["dependentSchemas"].(map[string]interface{}); ok {
+		for _, key := range sortedKeys(dependentSchemas) {
+			if _, exists := obj[key]; exists {
+				s.validate(out, dependentSchemas[key], obj, instancePath, schemaPath+"/dependentSchemas/"+escapeJSONPointer(key), depth+1)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additionalProperties, hasAdditional := schema["additionalProperties"]
+	propertyNames, hasPropertyNames := schema["propertyNames"]
+
+	for _, key := range sortedKeys(obj) {
+		value := obj[key]
+		propertyPath := instancePath + "/" + escapeJSONPointer(key)
+
+		if hasPropertyNames && !s.isValid(propertyNames, key, depth+1) {
+			fail("propertyNames", "invalid property name %q", key)
+		}
+
+		evaluated := false
+		if sub, ok := properties[key]; ok {
+			evaluated = true
+			s.validate(out, sub, value, propertyPath, schemaPath+"/properties/"+escapeJSONPointer(key), depth+1)
+		}
+		for _, pattern := range sortedKeys(patternProperties) {
+			if re := s.regexps[pattern]; re != nil && re.MatchString(key) {
+				evaluated = true
+				s.validate(out, patternProperties[pattern], value, propertyPath, schemaPath+"/patternProperties/"+escapeJSONPointer(pattern), depth+1)
+			}
+		}
+		if !evaluated && hasAdditional {
+			if b, ok := additionalProperties.(bool); ok && !b {
+				*out = append(*out, SchemaViolation{
+					InstancePath: propertyPath,
+					SchemaPath:   schemaPath + "/additionalProperties",
+					Message:      fmt.Sprintf("additional property %q is not allowed", key),
+				})
+				continue
+			}
+			s.validate(out, additionalProperties, value, propertyPath, schemaPath+"/additionalProperties", depth+1)
+		}
+	}
+}
+
+func matchesType(t interface{}, instance interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesSingleType(t, instance)
+	case []interface{}:
+		for _, item := range t {
+			if name, ok := item.(string); ok && matchesSingleType(name, instance) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesSingleType(t string, instance interface{}) bool {
+	actual := jsonTypeOf(instance)
+	if t == "number" && actual == "integer" {
+		return true
+	}
+	return t == actual
+}
+
+func formatSchemaType(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, item := range list {
+			names = append(names, fmt.Sprint(item))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if r, ok := toRat(v); ok && r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func toRat(v interface{}) (*big.Rat, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetString(string(n))
+}
+
+func toInt(v interface{}) (int, bool) {
+	r, ok := toRat(v)
+	if !ok || !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return int(r.Num().Int64()), true
+}
+
+// jsonEqual compares two generic JSON values, comparing numbers by their value.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := toRat(a)
+		br, bok := toRat(bn)
+		return aok && bok && ar.Cmp(br) == 0
+	case []interface{}:
+		bl, ok := b.([]interface{})
+		if !ok || len(a) != len(bl) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], bl[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bm, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := bm[k]
+			if !ok || !jsonEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,265 @@
+package jsonclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileSchema(t *testing.T) {
+	t.Run("throws if schema is not a valid json", func(t *testing.T) {
+		_, err := CompileSchema([]byte(`{`))
+		require.EqualError(t, err, "json schema: unexpected EOF")
+	})
+
+	t.Run("throws if schema is not an object or boolean", func(t *testing.T) {
+		_, err := CompileSchema([]byte(`{"properties": {"a": 3}}`))
+		require.EqualError(t, err, `json schema: schema at "/properties/a" must be an object or a boolean`)
+	})
+
+	t.Run("throws with invalid pattern", func(t *testing.T) {
+		_, err := CompileSchema([]byte(`{"pattern": "(["}`))
+		require.ErrorContains(t, err, `json schema: invalid pattern at "/pattern"`)
+	})
+
+	t.Run("throws with unresolvable ref", func(t *testing.T) {
+		_, err := CompileSchema([]byte(`{"$ref": "#/$defs/missing"}`))
+		require.EqualError(t, err, `json schema: unresolvable $ref "#/$defs/missing"`)
+
+		_, err = CompileSchema([]byte(`{"$ref": "https://example.org/schema.json"}`))
+		require.EqualError(t, err, `json schema: unsupported $ref "https://example.org/schema.json"`)
+	})
+
+	t.Run("compiles the ref targets under unknown keywords", func(t *testing.T) {
+		_, err := CompileSchema([]byte(`{"definitions": {"code": {"pattern": "(["}}, "$ref": "#/definitions/code"}`))
+		require.ErrorContains(t, err, `json schema: invalid pattern at "#/definitions/code/pattern"`)
+
+		schema, err := CompileSchema([]byte(`{"definitions": {"code": {"patternProperties": {"^x-": {"pattern": "^[a-z]+$"}}}}, "properties": {"a": {"$ref": "#/definitions/code"}}}`))
+		require.NoError(t, err)
+		violations, err := schema.ValidateJSON([]byte(`{"a": {"x-b": "B"}}`))
+		require.NoError(t, err)
+		require.Equal(t, []SchemaViolation{
+			{InstancePath: "/a/x-b", SchemaPath: "/properties/a/$ref/patternProperties/^x-/pattern", Message: `does not match pattern "^[a-z]+$"`},
+		}, violations)
+	})
+
+	t.Run("panics with MustCompileSchema", func(t *testing.T) {
+		require.Panics(t, func() {
+			MustCompileSchema([]byte(`3`))
+		})
+	})
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		schema     string
+		instance   string
+		violations []SchemaViolation
+	}{
+		{
+			name:     "boolean schemas",
+			schema:   `{"properties": {"a": true, "b": false}}`,
+			instance: `{"a": 1, "b": 2}`,
+			violations: []SchemaViolation{
+				{InstancePath: "/b", SchemaPath: "/properties/b", Message: "false schema does not allow any value"},
+			},
+		},
+		{
+			name:     "type",
+			schema:   `{"type": "object", "properties": {"n": {"type": "integer"}, "s": {"type": ["string", "null"]}, "f": {"type": "number"}}}`,
+			instance: `{"n": 1.5, "s": null, "f": 2}`,
+			violations: []SchemaViolation{
+				{InstancePath: "/n", SchemaPath: "/properties/n/type", Message: "expected type integer, got number"},
+			},
+		},
+		{
+			name:     "integer with zero fractional part",
+			schema:   `{"type": "integer"}`,
+			instance: `1.0`,
+		},
+		{
+			name:     "enum and const",
+			schema:   `{"properties": {"e": {"enum": ["a", 1, {"x": [1]}]}, "c": {"const": 2}}}`,
+			instance: `{"e": {"x": [1.0]}, "c": 3}`,
+			violations: []SchemaViolation{
+				{InstancePath: "/c", SchemaPath: "/properties/c/const", Message: "value does not match the constant value"},
+			},
+		},
+		{
+			name:     "numeric keywords",
+			schema:   `{"prefixItems": [{"minimum": 1}, {"maximum": 1}, {"exclusiveMinimum": 1}, {"exclusiveMaximum": 1}, {"multipleOf": 0.1}]}`,
+			instance: `[0, 2, 1, 1, 0.35]`,
+			violations: []SchemaViolation{
+				{InstancePath: "/0", SchemaPath: "/prefixItems/0/minimum", Message: "must be >= 1"},
+				{InstancePath: "/1", SchemaPath: "/prefixItems/1/maximum", Message: "must be <= 1"},
+				{InstancePath: "/2", SchemaPath: "/prefixItems/2/exclusiveMinimum", Message: "must be > 1"},
+				{InstancePath: "/3", SchemaPath: "/prefixItems/3/exclusiveMaximum", Message: "must be < 1"},
+				{InstancePath: "/4", SchemaPath: "/prefixItems/4/multipleOf", Message: "must be a multiple of 1/10"},
+			},
+		},
+		{
+			name:     "string keywords",
+			schema:   `{"prefixItems": [{"minLength": 2}, {"maxLength": 2}, {"pattern": "^a+$"}]}`,
+			instance: `["è", "abc", "ab"]`,
+			violations: []SchemaViolation{
+				{InstancePath: "/0", SchemaPath: "/prefixItems/0/minLength", Message: "length must be >= 2, got 1"},
+				{InstancePath: "/1", SchemaPath: "/prefixItems/1/maxLength", Message: "length must be <= 2, got 3"},
+				{InstancePath: "/2", SchemaPath: "/prefixItems/2/pattern", Message: `does not match pattern "^a+$"`},
+			},
+		},
+		{
+			name:     "array keywords",
+			schema:   `{"minItems": 4, "uniqueItems": true, "prefixItems": [{"type": "string"}], "items": {"type": "integer"}, "contains": {"const": 5}, "maxContains": 1}`,
+			instance: `["a", 1, 1]`,
+			violations: []SchemaViolation{
+				{InstancePath: "", SchemaPath: "/minItems", Message: "must have at least 4 items, got 3"},
+				{InstancePath: "", SchemaPath: "/uniqueItems", Message: "items at index 1 and 2 are equal"},
+				{InstancePath: "", SchemaPath: "/contains", Message: "must contain at least 1 matching items, got 0"},
+			},
+		},
+		{
+			name:     "min and max contains",
+			schema:   `{"contains": {"type": "integer"}, "minContains": 0, "maxContains": 1}`,
+			instance: `[1, 2]`,
+			violations: []SchemaViolation{
+				{InstancePath: "", SchemaPath: "/maxContains", Message: "must contain at most 1 matching items, got 2"},
+			},
+		},
+		{
+			name: "object keywords",
+			schema: `{
+				"required": ["id", "name"],
+				"maxProperties": 3,
+				"properties": {"id": {"type": "string"}},
+				"patternProperties": {"^x-": {"type": "boolean"}},
+				"additionalProperties": false,
+				"propertyNames": {"maxLength": 5},
+				"dependentRequired": {"id": ["name"]}
+			}`,
+			instance: `{"id": "1", "x-a": "no", "other": 1, "longname": 2}`,
+			violations: []SchemaViolation{
+				{InstancePath: "", SchemaPath: "/maxProperties", Message: "must have at most 3 properties, got 4"},
+				{InstancePath: "", SchemaPath: "/required", Message: `missing required property "name"`},
+				{InstancePath: "", SchemaPath: "/dependentRequired", Message: `property "name" is required when "id" is present`},
+				{InstancePath: "", SchemaPath: "/propertyNames", Message: `invalid property name "longname"`},
+				{InstancePath: "/longname", SchemaPath: "/additionalProperties", Message: `additional property "longname" is not allowed`},
+				{InstancePath: "/other", SchemaPath: "/additionalProperties", Message: `additional property "other" is not allowed`},
+				{InstancePath: "/x-a", SchemaPath: "/patternProperties/^x-/type", Message: "expected type boolean, got string"},
+			},
+		},
+		{
+			name:     "additionalProperties schema",
+			schema:   `{"properties": {"a": {}}, "additionalProperties": {"type": "integer"}}`,
+			instance: `{"a": "x", "b": "y"}`,
+			violations: []SchemaViolation{
+				{InstancePath: "/b", SchemaPath: "/additionalProperties/type", Message: "expected type integer, got string"},
+			},
+		},
+		{
+			name:     "composition keywords",
+			schema:   `{"prefixItems": [{"allOf": [{"type": "integer"}, {"minimum": 3}]}, {"anyOf": [{"type": "string"}, {"type": "boolean"}]}, {"oneOf": [{"type": "integer"}, {"minimum": 0}]}, {"not": {"type": "null"}}]}`,
+			instance: `[1, 2, 3, null]`,
+			violations: []SchemaViolation{
+				{InstancePath: "/0", SchemaPath: "/prefixItems/0/allOf/1/minimum", Message: "must be >= 3"},
+				{InstancePath: "/1", SchemaPath: "/prefixItems/1/anyOf", Message: "value does not match any of the schemas"},
+				{InstancePath: "/2", SchemaPath: "/prefixItems/2/oneOf", Message: "value must match exactly one schema, but matches 2"},
+				{InstancePath: "/3", SchemaPath: "/prefixItems/3/not", Message: "value must not match the schema"},
+			},
+		},
+		{
+			name:     "if then else",
+			schema:   `{"items": {"if": {"type": "string"}, "then": {"minLength": 2}, "else": {"type": "integer"}}}`,
+			instance: `["a", "ab", 1, true]`,
+			violations: []SchemaViolation{
+				{InstancePath: "/0", SchemaPath: "/items/then/minLength", Message: "length must be >= 2, got 1"},
+				{InstancePath: "/3", SchemaPath: "/items/else/type", Message: "expected type integer, got boolean"},
+			},
+		},
+		{
+			name:     "dependentSchemas",
+			schema:   `{"dependentSchemas": {"card": {"required": ["address"]}}}`,
+			instance: `{"card": "123"}`,
+			violations: []SchemaViolation{
+				{InstancePath: "", SchemaPath: "/dependentSchemas/card/required", Message: `missing required property "address"`},
+			},
+		},
+		{
+			name: "refs",
+			schema: `{
+				"$defs": {
+					"node": {"$anchor": "node", "type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#node"}}, "name": {"$ref": "#/$defs/name"}}},
+					"name": {"$id": "urn:name", "type": "string"}
+				},
+				"properties": {"root": {"$ref": "#/$defs/node"}, "other": {"$ref": "urn:name"}}
+			}`,
+			instance: `{"root": {"name": "a", "children": [{"name": 1}]}, "other": 2}`,
+			violations: []SchemaViolation{
+				{InstancePath: "/other", SchemaPath: "/properties/other/$ref/type", Message: "expected type string, got integer"},
+				{InstancePath: "/root/children/0/name", SchemaPath: "/properties/root/$ref/properties/children/items/$ref/properties/name/$ref/type", Message: "expected type string, got integer"},
+			},
+		},
+		{
+			name: "relative refs in nested $id",
+			schema: `{
+				"$id": "https://example.com/schemas/root.json",
+				"$defs": {
+					"item": {"$id": "item.json", "type": "integer"},
+					"list": {"$id": "lists/list.json", "items": {"$ref": "../item.json"}, "$defs": {"max": {"maxItems": 1}}, "allOf": [{"$ref": "#/$defs/max"}]}
+				},
+				"properties": {"list": {"$ref": "lists/list.json"}, "item": {"$ref": "https://example.com/schemas/item.json"}}
+			}`,
+			instance: `{"list": [1, "a"], "item": "b"}`,
+			violations: []SchemaViolation{
+				{InstancePath: "/item", SchemaPath: "/properties/item/$ref/type", Message: "expected type integer, got string"},
+				{InstancePath: "/list/1", SchemaPath: "/properties/list/$ref/items/$ref/type", Message: "expected type integer, got string"},
+				{InstancePath: "/list", SchemaPath: "/properties/list/$ref/allOf/0/$ref/maxItems", Message: "must have at most 1 items, got 2"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := CompileSchema([]byte(test.schema))
+			require.NoError(t, err)
+
+			violations, err := schema.ValidateJSON([]byte(test.instance))
+			require.NoError(t, err)
+			require.Equal(t, test.violations, violations)
+		})
+	}
+
+	t.Run("recursive ref does not loop forever", func(t *testing.T) {
+		schema := MustCompileSchema([]byte(`{"$ref": "#"}`))
+
+		violations, err := schema.ValidateJSON([]byte(`{}`))
+		require.NoError(t, err)
+		require.Len(t, violations, 1)
+		require.Equal(t, "maximum schema depth exceeded", violations[0].Message)
+	})
+
+	t.Run("validate go values", func(t *testing.T) {
+		schema := MustCompileSchema([]byte(`{"type": "object", "required": ["name"]}`))
+
+		violations, err := schema.Validate(struct {
+			Name string `json:"name"`
+		}{})
+		require.NoError(t, err)
+		require.Empty(t, violations)
+
+		violations, err = schema.Validate(map[string]string{})
+		require.NoError(t, err)
+		require.Equal(t, []SchemaViolation{
+			{InstancePath: "", SchemaPath: "/required", Message: `missing required property "name"`},
+		}, violations)
+	})
+
+	t.Run("throws if value is not valid json", func(t *testing.T) {
+		schema := MustCompileSchema([]byte(`true`))
+
+		_, err := schema.ValidateJSON([]byte(`{`))
+		require.Error(t, err)
+		_, err = schema.Validate(make(chan int))
+		require.Error(t, err)
+	})
+}
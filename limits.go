@@ -0,0 +1,82 @@
+package jsonclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDrainSize is the maximum number of bytes read from a response body before
+// closing it, to allow the connection to be reused.
+const maxDrainSize = 64 << 10
+
+// ErrBodyTooLarge define a response body exceeding the configured size limit
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// BodyTooLargeError struct define a response body exceeding the configured
+// size limit. Read is the number of bytes read before stopping.
+type BodyTooLargeError struct {
+	Limit int64
+	Read  int64
+	Err   error
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("%s: read %d bytes, limit is %d bytes", e.Err, e.Read, e.Limit)
+}
+
+func (e *BodyTooLargeError) Unwrap() error {
+	return e.Err
+}
+
+// limitedReader returns at most limit bytes, then a BodyTooLargeError if the
+// underlying reader has more data.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func newLimitedReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, limit: limit}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, l.err()
+	}
+	if remaining := l.limit + 1 - l.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), l.err()
+	}
+	return n, err
+}
+
+func (l *limitedReader) err() error {
+	return &BodyTooLargeError{Limit: l.limit, Read: l.read, Err: ErrBodyTooLarge}
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readLimited reads all the reader, up to limit bytes. If the limit is
+// exceeded, it returns the data read until the limit and a BodyTooLargeError.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	return io.ReadAll(newLimitedReader(r, limit))
+}
+
+// drainAndClose reads a bounded amount of the body and closes it, so that the
+// connection could be reused if the body is fully read.
+func drainAndClose(body io.ReadCloser) error {
+	io.CopyN(io.Discard, body, maxDrainSize)
+	return body.Close()
+}
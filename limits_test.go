@@ -0,0 +1,131 @@
+package jsonclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedReader(t *testing.T) {
+	t.Run("reads body smaller than limit", func(t *testing.T) {
+		data, err := readLimited(strings.NewReader("12345"), 5)
+		require.NoError(t, err)
+		require.Equal(t, "12345", string(data))
+	})
+
+	t.Run("throws if body is larger than limit", func(t *testing.T) {
+		data, err := readLimited(strings.NewReader("123456789"), 5)
+		require.Equal(t, "12345", string(data))
+		require.EqualError(t, err, "response body too large: read 6 bytes, limit is 5 bytes")
+
+		var tooLarge *BodyTooLargeError
+		require.True(t, errors.As(err, &tooLarge))
+		require.Equal(t, int64(5), tooLarge.Limit)
+		require.Equal(t, int64(6), tooLarge.Read)
+		require.True(t, errors.Is(err, ErrBodyTooLarge))
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		data, err := readLimited(strings.NewReader("123456789"), 0)
+		require.NoError(t, err)
+		require.Equal(t, "123456789", string(data))
+	})
+}
+
+func TestCheckResponseWithLimit(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 500,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"message":"a very long error"}`)),
+		Request: &http.Request{
+			Method: "METHOD",
+			URL:    &url.URL{Path: "/request-url"},
+		},
+	}
+
+	err := checkResponseWithLimit(resp, 10)
+	require.EqualError(t, err, `METHOD /request-url: 500 - {"message"`)
+
+	var httpErr *HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	require.Equal(t, []byte(`{"message"`), httpErr.Raw)
+	require.True(t, errors.Is(err, ErrHTTP))
+	require.True(t, errors.Is(err, ErrBodyTooLarge))
+	var tooLarge *BodyTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, int64(10), tooLarge.Limit)
+}
+
+func TestDoWithLimits(t *testing.T) {
+	largeBody := fmt.Sprintf(`{"message": "%s"}`, strings.Repeat("a", 1000))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/error" {
+			w.WriteHeader(400)
+		}
+		w.Write([]byte(largeBody))
+	}))
+	defer s.Close()
+
+	newClient := func(t *testing.T, opts Options) *Client {
+		opts.BaseURL = s.URL
+		client, err := New(opts)
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("throws if success body exceeds limit", func(t *testing.T) {
+		client := newClient(t, Options{MaxBodySize: 100})
+		req, err := client.NewRequest(http.MethodGet, "ok", nil)
+		require.NoError(t, err)
+
+		v := map[string]string{}
+		resp, err := client.Do(req, &v)
+		require.Nil(t, resp)
+		var tooLarge *BodyTooLargeError
+		require.True(t, errors.As(err, &tooLarge))
+		require.Equal(t, int64(100), tooLarge.Limit)
+	})
+
+	t.Run("decodes body within limit", func(t *testing.T) {
+		client := newClient(t, Options{MaxBodySize: 2000, MaxWriterSize: 10})
+		req, err := client.NewRequest(http.MethodGet, "ok", nil)
+		require.NoError(t, err)
+
+		v := map[string]string{}
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Len(t, v["message"], 1000)
+	})
+
+	t.Run("throws if writer body exceeds limit", func(t *testing.T) {
+		client := newClient(t, Options{MaxBodySize: 10, MaxWriterSize: 100})
+		req, err := client.NewRequest(http.MethodGet, "ok", nil)
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		resp, err := client.Do(req, buf)
+		require.Nil(t, resp)
+		require.True(t, errors.Is(err, ErrBodyTooLarge))
+		require.Equal(t, 100, buf.Len())
+	})
+
+	t.Run("truncates error body", func(t *testing.T) {
+		client := newClient(t, Options{MaxErrorBodySize: 20})
+		req, err := client.NewRequest(http.MethodGet, "error", nil)
+		require.NoError(t, err)
+
+		_, err = client.Do(req, nil)
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		require.Equal(t, 400, httpErr.StatusCode)
+		require.Len(t, httpErr.Raw, 20)
+		require.True(t, errors.Is(err, ErrBodyTooLarge))
+	})
+}
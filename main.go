@@ -3,7 +3,6 @@ package jsonclient
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,7 +18,17 @@ type Client struct {
 	DefaultHeaders Headers
 	Host           string
 
-	client *http.Client
+	client           *http.Client
+	validator        *SchemaValidator
+	maxBodySize      int64
+	maxErrorBodySize int64
+	maxWriterSize    int64
+	strictDecoding   bool
+	hedger           *hedger
+	coalescer        *coalescer
+	pool             *endpointPool
+	shadow           *shadowMirror
+	idempotencyKeys  bool
 }
 
 // Options to pass to create a new client
@@ -28,29 +37,90 @@ type Options struct {
 	Headers    Headers
 	HTTPClient *http.Client
 	Host       string
+	// HostAsServerName makes Host also the TLS server name, sent as SNI and
+	// used to verify the server certificate, e.g. when BaseURL is an ip
+	// address or an internal load balancer. It applies only to the
+	// connections to the BaseURL (or Endpoints) hosts, not through a proxy.
+	HostAsServerName bool
+	// Resolve maps host:port pairs to the addresses dialed instead of
+	// resolving the host, like the curl --resolve flag, e.g.
+	// {"api.example.com:443": {"10.0.0.1", "10.0.0.2"}}. It is ignored for
+	// the requests sent through a proxy (including SOCKS5 ones), whose hosts
+	// are resolved by the proxy.
+	Resolve map[string][]string
+	// CookieJar, if set, stores the cookies of the responses and sends them
+	// with the requests. NewCookieJar creates a jar persisted to a file.
+	CookieJar http.CookieJar
+	// Proxy, if set, is the proxy of the requests, instead of the one of the
+	// HTTPClient transport.
+	Proxy *ProxyConfig
+	// SchemaValidator, if set, validates request and response bodies against
+	// the JSON Schemas registered for their route.
+	SchemaValidator *SchemaValidator
+	// MaxBodySize is the maximum size, in bytes, of a successful response body
+	// decoded in Do. Zero means no limit.
+	MaxBodySize int64
+	// MaxErrorBodySize is the maximum size, in bytes, of the error response
+	// body kept in HTTPError.Raw. Zero means no limit.
+	MaxErrorBodySize int64
+	// MaxWriterSize is the maximum size, in bytes, of a successful response
+	// body copied to an io.Writer in Do. Zero means no limit.
+	MaxWriterSize int64
+	// StrictDecoding makes Do reject response bodies with unknown fields,
+	// trailing data after the json value, or empty bodies (except for 204
+	// and 205 status codes). It could be overridden per request with
+	// WithStrictDecoding.
+	StrictDecoding bool
+	// Hedging, if set, hedges idempotent requests (GET and HEAD without body)
+	// to reduce the tail latency.
+	Hedging *HedgingPolicy
+	// Coalescing, if set, shares a single request among the identical GET
+	// and HEAD requests in flight at the same time.
+	Coalescing *CoalescingPolicy
+	// Endpoints, if set, is a pool of base urls used instead of BaseURL,
+	// selected when each request is sent.
+	Endpoints *EndpointPool
+	// Shadow, if set, mirrors a percentage of the requests to a secondary
+	// base url, comparing the responses.
+	Shadow *ShadowTraffic
+	// UnixSocket, if set, is the path of the unix socket dialed for all the
+	// requests. BaseURL, if not set, defaults to `http://localhost/`.
+	// The socket could also be set in BaseURL, as
+	// `unix:///var/run/agent.sock:/v1/`.
+	UnixSocket string
+	// TLS, if set, configures the client certificates, the trusted CAs and
+	// the TLS version of the connections, reloading the certificate files
+	// when they change.
+	TLS *TLSConfig
+	// Pinning, if set, verifies the SHA-256 SPKI pins of the server
+	// certificate chains.
+	Pinning *PinningConfig
+	// IdempotencyKeys adds a generated Idempotency-Key header to POST and
+	// PATCH requests, reused by their retries. The key could be set per
+	// request with WithIdempotencyKey.
+	IdempotencyKeys bool
 }
 
 // New function create a client using passed options
 // BaseURL must be an HTTP or HTTPs absolute url and have a trailing slash
 func New(opts Options) (*Client, error) {
-	baseUrlToParse, err := url.JoinPath(opts.BaseURL, "/")
+	rawBaseURL, socket, isUnix, err := parseUnixBaseURL(opts.BaseURL)
 	if err != nil {
 		return nil, err
 	}
-
-	baseURL, err := url.Parse(baseUrlToParse)
-	if err != nil {
-		return nil, err
+	if isUnix && opts.UnixSocket != "" {
+		return nil, fmt.Errorf("unix baseURL and unix socket cannot be both set")
 	}
-	if isBaseURLSet(opts.BaseURL) {
-		if !baseURL.IsAbs() {
-			return nil, fmt.Errorf("baseURL should be an absolute url")
+	if opts.UnixSocket != "" {
+		socket = opts.UnixSocket
+		if !isBaseURLSet(rawBaseURL) {
+			rawBaseURL = unixBaseURL("/")
 		}
+	}
 
-		scheme := baseURL.Scheme
-		if scheme != "http" && scheme != "https" {
-			return nil, fmt.Errorf("unsupported scheme: %s", scheme)
-		}
+	baseURL, err := parseBaseURL(rawBaseURL)
+	if err != nil {
+		return nil, err
 	}
 
 	client := &Client{
@@ -66,13 +136,155 @@ func New(opts Options) (*Client, error) {
 	if opts.HTTPClient != nil {
 		client.client = opts.HTTPClient
 	}
+	if opts.CookieJar != nil {
+		httpClient := *client.client
+		httpClient.Jar = opts.CookieJar
+		client.client = &httpClient
+	}
 	if opts.Host != "" {
 		client.Host = opts.Host
 	}
+	var reloader *tlsReloader
+	if opts.TLS != nil {
+		reloader, err = newTLSReloader(*opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Pinning != nil {
+		pinner, err := newPinner(*opts.Pinning)
+		if err != nil {
+			return nil, err
+		}
+		client.client, err = withTransport(client.client, "pinning", pinner.configure)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.HostAsServerName {
+		if opts.Host == "" {
+			return nil, fmt.Errorf("host as server name without host")
+		}
+		if opts.TLS != nil && opts.TLS.ServerName != "" {
+			return nil, fmt.Errorf("host as server name and tls server name cannot be both set")
+		}
+	}
+	if len(opts.Resolve) != 0 {
+		resolve, err := parseResolve(opts.Resolve)
+		if err != nil {
+			return nil, err
+		}
+		client.client, err = withTransport(client.client, "resolve", resolveDialer(resolve))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Proxy != nil {
+		if socket != "" {
+			return nil, fmt.Errorf("unix socket and proxy cannot be both set")
+		}
+		proxy, err := newProxySelector(*opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		client.client, err = withTransport(client.client, "proxy", proxy.configure)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the tls dialer uses the dial and the tls configuration of the other
+	// options. The shadow mirror does not use the host as server name.
+	shadowClient := client.client
+	if reloader != nil {
+		shadowClient, err = withTransport(client.client, "tls", newTLSDialer(reloader, nil).configure)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.HostAsServerName {
+		baseURLs := []string{client.BaseURL.String()}
+		if opts.Endpoints != nil {
+			baseURLs = append(baseURLs, opts.Endpoints.BaseURLs...)
+		}
+		feature := "host as server name"
+		if reloader != nil {
+			feature = "tls"
+		}
+		client.client, err = withTransport(client.client, feature, newTLSDialer(reloader, hostServerNames(opts.Host, baseURLs)).configure)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		client.client = shadowClient
+	}
+	if opts.SchemaValidator != nil {
+		client.validator = opts.SchemaValidator
+	}
+	client.maxBodySize = opts.MaxBodySize
+	client.maxErrorBodySize = opts.MaxErrorBodySize
+	client.maxWriterSize = opts.MaxWriterSize
+	client.strictDecoding = opts.StrictDecoding
+	client.idempotencyKeys = opts.IdempotencyKeys
+	if opts.Hedging != nil {
+		client.hedger = newHedger(*opts.Hedging)
+	}
+	if opts.Coalescing != nil {
+		client.coalescer = newCoalescer(*opts.Coalescing)
+	}
+	if opts.Endpoints != nil {
+		if isBaseURLSet(opts.BaseURL) {
+			return nil, fmt.Errorf("baseURL and endpoints cannot be both set")
+		}
+		if socket != "" {
+			return nil, fmt.Errorf("unix socket and endpoints cannot be both set")
+		}
+		client.pool, err = newEndpointPool(*opts.Endpoints, client.client)
+		if err != nil {
+			return nil, err
+		}
+		client.BaseURL = client.pool.endpoints[0].baseURL
+	}
+	if opts.Shadow != nil {
+		client.shadow, err = newShadowMirror(*opts.Shadow, shadowClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if socket != "" {
+		client.client, err = unixSocketClient(client.client, socket)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return client, nil
 }
 
+// parseBaseURL parses the base url, adding the trailing slash. An empty base
+// url is allowed.
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	baseUrlToParse, err := url.JoinPath(rawURL, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, err := url.Parse(baseUrlToParse)
+	if err != nil {
+		return nil, err
+	}
+	if isBaseURLSet(rawURL) {
+		if !baseURL.IsAbs() {
+			return nil, fmt.Errorf("baseURL should be an absolute url")
+		}
+
+		scheme := baseURL.Scheme
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("unsupported scheme: %s", scheme)
+		}
+	}
+	return baseURL, nil
+}
+
 // NewRequestWithContext function works like the function of `net/http` package,
 // simplified to a easier use with json request.
 // Context and method are handled in the same way of core `net/http` package.
@@ -82,10 +294,13 @@ func New(opts Options) (*Client, error) {
 // urlString should not starts with `/` (otherwise BaseURL is not set)
 // * body params in converted to a `json` buffer. If body is passed, the header
 // `Content-Type: application/json` is automatically added to the request.
+// If body implements ContentTyper, its content type is used instead.
 //
 // To the request are added all the DefaultHeaders (if body is passed,
-// `application/json` content-type takes precedence over DefaultHeaders).
-func (c *Client) NewRequestWithContext(ctx context.Context, method string, urlStr string, body interface{}) (*http.Request, error) {
+// the body content-type takes precedence over DefaultHeaders), then the
+// request options are applied.
+func (c *Client) NewRequestWithContext(ctx context.Context, method string, urlStr string, body interface{}, opts ...RequestOption) (*http.Request, error) {
+	cfg := newRequestConfig(opts)
 	parsedURLStr, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, err
@@ -93,81 +308,261 @@ func (c *Client) NewRequestWithContext(ctx context.Context, method string, urlSt
 	if c.BaseURL.IsAbs() && parsedURLStr.IsAbs() {
 		return nil, fmt.Errorf("baseURL and urlStr cannot be both absolute")
 	}
+	if cfg != nil && len(cfg.query) != 0 {
+		cfg.applyQuery(parsedURLStr)
+		urlStr = parsedURLStr.String()
+	}
+	ctx = cfg.contextWith(ctx)
+
+	if c.pool != nil && !parsedURLStr.IsAbs() {
+		ctx = context.WithValue(ctx, endpointRefKey{}, true)
+	}
 
 	u, err := c.BaseURL.Parse(urlStr)
 	if err != nil {
 		return nil, err
 	}
 
-	var buffer io.ReadWriter
+	if stream, ok := body.(*StreamBody); ok {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		setStreamBody(req, stream)
+		c.setRequestHeaders(req, body, cfg)
+		if err := c.setIdempotencyKey(req); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+		return req, nil
+	}
+
+	var buffer *bytes.Buffer
 	if body != nil {
 		buffer = &bytes.Buffer{}
-		enc := json.NewEncoder(buffer)
-		enc.SetEscapeHTML(false)
-		err := enc.Encode(body)
-		if err != nil {
+		if err := cfg.encode(buffer, body); err != nil {
 			return nil, err
 		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), buffer)
+	var reqBody io.Reader
+	if buffer != nil {
+		reqBody = buffer
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
 	if err != nil {
 		return nil, err
 	}
 
+	if c.validator != nil && buffer != nil && cfg.codec() == nil {
+		if err := c.validator.validateRequest(req, c.BaseURL.Path, buffer.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	c.setRequestHeaders(req, body, cfg)
+	if err := c.setIdempotencyKey(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (c *Client) setRequestHeaders(req *http.Request, body interface{}, cfg *requestConfig) {
 	for k, v := range c.DefaultHeaders {
 		req.Header.Set(k, v)
 	}
 
 	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+		if codec := cfg.codec(); codec != nil {
+			req.Header.Set("Content-Type", codec.ContentType())
+		} else {
+			req.Header.Set("Content-Type", contentTypeOf(body))
+		}
 	}
 	if c.Host != "" {
 		req.Host = c.Host
 	}
-
-	return req, nil
+	cfg.applyHeaders(req.Header)
 }
 
 // NewRequest function is same of NewRequestWithContext, without context
-func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
-	return c.NewRequestWithContext(context.Background(), method, urlStr, body)
+func (c *Client) NewRequest(method, urlStr string, body interface{}, opts ...RequestOption) (*http.Request, error) {
+	return c.NewRequestWithContext(context.Background(), method, urlStr, body, opts...)
 }
 
 // Do function executes http request using the passed request.
 // This function automatically handles response in json to be decoded and saved
 // into the `v` param.
 func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
-	resp, err := c.client.Do(req)
+	resp, done, err := c.exchange(req, c.sendWithRetry)
 	if err != nil {
-		select {
-		case <-req.Context().Done():
-			return nil, req.Context().Err()
-		default:
-		}
 		return nil, err
 	}
-	defer resp.Body.Close()
+	defer done()
+	cfg := requestConfigFrom(req)
+
+	maxSize := c.maxBodySize
+	if _, ok := v.(io.Writer); ok {
+		maxSize = c.maxWriterSize
+	}
+	if maxSize > 0 {
+		resp.Body = limitedReadCloser{
+			Reader: newLimitedReader(resp.Body, maxSize),
+			Closer: resp.Body,
+		}
+	}
 
-	respErr := checkResponse(resp)
-	if respErr != nil {
-		return nil, respErr
+	if c.validator != nil {
+		if err := c.validator.validateResponse(req, resp, c.BaseURL.Path); err != nil {
+			return nil, err
+		}
 	}
 
 	if v != nil {
 		if w, ok := v.(io.Writer); ok {
-			io.Copy(w, resp.Body)
-		} else {
-			err := json.NewDecoder(resp.Body).Decode(v)
-			if err != nil && err != io.EOF {
+			if _, err := io.Copy(w, resp.Body); err != nil {
+				return nil, err
+			}
+		} else if codec := cfg.codec(); codec != nil {
+			if err := codec.Decode(resp.Body, v); err != nil {
 				return nil, err
 			}
+		} else if err := decodeResponse(resp, v, c.isStrictDecoding(req)); err != nil {
+			return nil, err
 		}
 	}
 
 	return resp, nil
 }
 
+// exchange sends the request with send, mirroring it to the shadow
+// environment, and checks the response with the response hook and the
+// expected statuses. The returned done func must be called once the response
+// body has been read.
+func (c *Client) exchange(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, func(), error) {
+	cfg := requestConfigFrom(req)
+	cancel := func() {}
+	if cfg != nil && cfg.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), cfg.timeout)
+		req = req.WithContext(ctx)
+	}
+
+	var shadow *shadowRequest
+	var primary *http.Response
+	var body io.ReadCloser
+	if c.shadow != nil {
+		shadow = c.shadow.start(req, c.BaseURL)
+	}
+	done := func() {
+		if body != nil {
+			drainAndClose(body)
+		}
+		if shadow != nil {
+			shadow.finish(primary)
+		}
+		cancel()
+	}
+
+	resp, err := send(req)
+	if streamErr := streamError(req); streamErr != nil {
+		if err == nil {
+			drainAndClose(resp.Body)
+		}
+		done()
+		return nil, nil, streamErr
+	}
+	if err != nil {
+		select {
+		case <-req.Context().Done():
+			err = req.Context().Err()
+		default:
+		}
+		done()
+		return nil, nil, err
+	}
+	primary = resp
+	if shadow != nil {
+		shadow.captureResponse(resp)
+	}
+	body = resp.Body
+
+	if err := checkResponseHook(req, resp); err != nil {
+		done()
+		return nil, nil, err
+	}
+	if cfg != nil && len(cfg.expectedStatuses) != 0 {
+		if !cfg.isExpectedStatus(resp.StatusCode) {
+			err = idempotencyError(req, newHTTPError(resp, c.maxErrorBodySize))
+		}
+	} else if respErr := checkResponseWithLimit(resp, c.maxErrorBodySize); respErr != nil {
+		err = idempotencyError(req, respErr)
+	}
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	return resp, done, nil
+}
+
+// send sends the request, sharing it with the identical requests in flight
+// if coalescing is enabled.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.coalescer != nil && canHedge(req) {
+		return c.coalescer.do(req, c.coalescingLimit(), c.sendToEndpoint)
+	}
+	return c.sendToEndpoint(req)
+}
+
+// sendToEndpoint sends the request to the endpoint selected from the pool,
+// if the request url is relative to it.
+func (c *Client) sendToEndpoint(req *http.Request) (*http.Response, error) {
+	if ref, ok := c.endpointRef(req); ok {
+		return c.pool.do(req, ref, c.roundTrip)
+	}
+	return c.roundTrip(req)
+}
+
+// roundTrip sends the request with the http client, hedging it if configured.
+// The request hook, if any, is run with the url resolved.
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	runRequestHook(req)
+	if c.hedger != nil && canHedge(req) {
+		return c.hedger.do(c.client, req)
+	}
+	return c.client.Do(req)
+}
+
+// withTransport returns a copy of client with a copy of its transport
+// modified by configure. feature names the option requiring the transport in
+// the returned error.
+func withTransport(client *http.Client, feature string, configure func(*http.Transport)) (*http.Client, error) {
+	var transport http.RoundTripper
+	switch t := client.Transport.(type) {
+	case nil:
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		configure(base)
+		transport = base
+	case *http.Transport:
+		base := t.Clone()
+		configure(base)
+		transport = base
+	default:
+		return nil, fmt.Errorf("%s requires an *http.Transport, got %T", feature, client.Transport)
+	}
+
+	newClient := *client
+	newClient.Transport = transport
+	return &newClient, nil
+}
+
+func contentTypeOf(body interface{}) string {
+	if ct, ok := body.(ContentTyper); ok && ct.ContentType() != "" {
+		return ct.ContentType()
+	}
+	return "application/json"
+}
+
 func isBaseURLSet(baseURL string) bool {
 	return baseURL != ""
 }
@@ -357,7 +357,9 @@ func TestDo(t *testing.T) {
 		resp, err := client.Do(req, &v)
 		require.Nil(t, resp, "response is not nil")
 		require.Exactly(t, Response{}, v)
-		require.EqualError(t, err, "invalid character 'n' looking for beginning of object key string", "wrong do request due to malformed json")
+		var syntaxErr *json.SyntaxError
+		require.True(t, errors.As(err, &syntaxErr), "wrong do request due to malformed json")
+		require.EqualError(t, syntaxErr, "invalid character 'n' looking for beginning of object key string")
 	})
 
 	t.Run("throws if request context done", func(t *testing.T) {
@@ -0,0 +1,234 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestOption customizes a single request. Options are accepted by
+// NewRequestWithContext, NewRequest and the other request constructors of
+// the Client, and are applied in order.
+type RequestOption func(*requestConfig)
+
+// Codec encodes request bodies and decodes response bodies, replacing json.
+type Codec interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+type requestConfig struct {
+	headers          []func(http.Header)
+	query            []func(url.Values)
+	timeout          time.Duration
+	expectedStatuses []int
+	bodyCodec        Codec
+	retry            *RetryPolicy
+	tags             map[string]string
+	strictDecoding   *bool
+	hashKey          *string
+}
+
+type requestConfigKey struct{}
+
+func newRequestConfig(opts []RequestOption) *requestConfig {
+	if len(opts) == 0 {
+		return nil
+	}
+	cfg := &requestConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// requestConfigFrom returns the options of the request, or nil.
+func requestConfigFrom(req *http.Request) *requestConfig {
+	cfg, _ := req.Context().Value(requestConfigKey{}).(*requestConfig)
+	return cfg
+}
+
+// WithHeader sets the request header, replacing the default headers.
+func WithHeader(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.headers = append(cfg.headers, func(h http.Header) { h.Set(key, value) })
+	}
+}
+
+// WithAddedHeader adds a value to the request header.
+func WithAddedHeader(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.headers = append(cfg.headers, func(h http.Header) { h.Add(key, value) })
+	}
+}
+
+// WithoutHeader removes the request header, e.g. a default header.
+func WithoutHeader(key string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.headers = append(cfg.headers, func(h http.Header) { h.Del(key) })
+	}
+}
+
+// WithQuery sets the query param of the request url.
+func WithQuery(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.query = append(cfg.query, func(q url.Values) { q.Set(key, value) })
+	}
+}
+
+// WithAddedQuery adds a value to the query param of the request url.
+func WithAddedQuery(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.query = append(cfg.query, func(q url.Values) { q.Add(key, value) })
+	}
+}
+
+// WithTimeout sets the timeout of the request, applied in Do, including the
+// reading of the response body.
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithExpectedStatus sets the status codes considered successful by Do,
+// instead of the 2xx ones. Responses with other status codes return an
+// HTTPError.
+func WithExpectedStatus(codes ...int) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.expectedStatuses = append(cfg.expectedStatuses, codes...)
+	}
+}
+
+// WithCodec encodes the request body and decodes the response body with the
+// codec, instead of json. Bodies encoded with a codec are not validated by
+// the SchemaValidator, nor strictly decoded.
+func WithCodec(codec Codec) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.bodyCodec = codec
+	}
+}
+
+// WithBearerToken sets the Authorization header of the request to the bearer
+// token, overriding the default headers.
+func WithBearerToken(token string) RequestOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithBasicAuth sets the Authorization header of the request to the basic
+// credentials, overriding the default headers.
+func WithBasicAuth(username, password string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.headers = append(cfg.headers, func(h http.Header) {
+			req := &http.Request{Header: http.Header{}}
+			req.SetBasicAuth(username, password)
+			h.Set("Authorization", req.Header.Get("Authorization"))
+		})
+	}
+}
+
+// RetryPolicy struct define how a failed request is retried by Do. Only
+// requests with an idempotent method or with an Idempotency-Key header are
+// retried, on transport errors and on 429, 502, 503 and 504 status codes.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Values lower than 2 disable the retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled at each attempt.
+	// Default to 100ms.
+	Backoff time.Duration
+	// MaxBackoff, if set, caps the delay between the attempts, including the
+	// one requested by the Retry-After header.
+	MaxBackoff time.Duration
+}
+
+// WithRetry sets the retry policy of the request. By default, the requests
+// are not retried.
+func WithRetry(policy RetryPolicy) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.retry = &policy
+	}
+}
+
+// WithTags adds tags to the request, e.g. to label metrics. They could be
+// retrieved with TagsFromRequest.
+func WithTags(tags map[string]string) RequestOption {
+	return func(cfg *requestConfig) {
+		if cfg.tags == nil {
+			cfg.tags = map[string]string{}
+		}
+		for k, v := range tags {
+			cfg.tags[k] = v
+		}
+	}
+}
+
+// TagsFromRequest returns a copy of the tags of the request, set with
+// WithTags.
+func TagsFromRequest(req *http.Request) map[string]string {
+	cfg := requestConfigFrom(req)
+	if cfg == nil || cfg.tags == nil {
+		return nil
+	}
+	tags := make(map[string]string, len(cfg.tags))
+	for k, v := range cfg.tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+func (cfg *requestConfig) applyQuery(u *url.URL) {
+	if cfg == nil || len(cfg.query) == 0 {
+		return
+	}
+	q := u.Query()
+	for _, apply := range cfg.query {
+		apply(q)
+	}
+	u.RawQuery = q.Encode()
+}
+
+func (cfg *requestConfig) applyHeaders(h http.Header) {
+	if cfg == nil {
+		return
+	}
+	for _, apply := range cfg.headers {
+		apply(h)
+	}
+}
+
+func (cfg *requestConfig) contextWith(ctx context.Context) context.Context {
+	if cfg == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, requestConfigKey{}, cfg)
+}
+
+func (cfg *requestConfig) encode(w io.Writer, body interface{}) error {
+	if codec := cfg.codec(); codec != nil {
+		return codec.Encode(w, body)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(body)
+}
+
+func (cfg *requestConfig) isExpectedStatus(code int) bool {
+	for _, expected := range cfg.expectedStatuses {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *requestConfig) codec() Codec {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.bodyCodec
+}
@@ -0,0 +1,142 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string { return "application/xml" }
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error { return xml.NewEncoder(w).Encode(v) }
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error { return xml.NewDecoder(r).Decode(v) }
+
+func TestRequestOptions(t *testing.T) {
+	client, err := New(Options{
+		BaseURL: "http://localhost:8080/api/",
+		Headers: Headers{"Authorization": "Bearer default", "X-Remove": "1", "X-Multi": "a"},
+	})
+	require.NoError(t, err)
+
+	t.Run("headers and auth", func(t *testing.T) {
+		req, err := client.NewRequest(http.MethodGet, "resource", nil,
+			WithHeader("X-Set", "1"),
+			WithAddedHeader("X-Multi", "b"),
+			WithoutHeader("X-Remove"),
+			WithBearerToken("token"),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "1", req.Header.Get("X-Set"))
+		require.Equal(t, []string{"a", "b"}, req.Header.Values("X-Multi"))
+		require.Empty(t, req.Header.Values("X-Remove"))
+		require.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+		req, err = client.NewRequest(http.MethodGet, "resource", nil, WithBasicAuth("user", "pass"))
+		require.NoError(t, err)
+		username, password, ok := req.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user", username)
+		require.Equal(t, "pass", password)
+	})
+
+	t.Run("query params", func(t *testing.T) {
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodGet, "resource?a=1&b=2", nil,
+			WithQuery("a", "3"),
+			WithAddedQuery("b", "4"),
+			WithQuery("c", "x y"),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "http://localhost:8080/api/resource?a=3&b=2&b=4&c=x+y", req.URL.String())
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		req, err := client.NewRequest(http.MethodGet, "resource", nil,
+			WithTags(map[string]string{"route": "resource", "team": "a"}),
+			WithTags(map[string]string{"team": "b"}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"route": "resource", "team": "b"}, TagsFromRequest(req))
+
+		req, err = client.NewRequest(http.MethodGet, "resource", nil)
+		require.NoError(t, err)
+		require.Nil(t, TagsFromRequest(req))
+	})
+
+	t.Run("template and patch requests", func(t *testing.T) {
+		req, err := client.NewTemplateRequest(http.MethodGet, "users/{id}", TemplateVars{"id": 1}, nil, WithQuery("q", "1"))
+		require.NoError(t, err)
+		require.Equal(t, "http://localhost:8080/api/users/1?q=1", req.URL.String())
+
+		req, err = client.NewMergePatchRequestWithContext(context.Background(), "users/1", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}, WithHeader("If-Match", "etag"))
+		require.NoError(t, err)
+		require.Equal(t, "etag", req.Header.Get("If-Match"))
+	})
+}
+
+func TestRequestOptionsDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/slow":
+			<-req.Context().Done()
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 1}`))
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		case "/xml":
+			require.Equal(t, "application/xml", req.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(req.Body)
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Options{BaseURL: server.URL})
+	require.NoError(t, err)
+
+	t.Run("timeout", func(t *testing.T) {
+		req, err := client.NewRequest(http.MethodGet, "slow", nil, WithTimeout(10*time.Millisecond))
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("expected statuses", func(t *testing.T) {
+		req, err := client.NewRequest(http.MethodGet, "not-modified", nil, WithExpectedStatus(http.StatusOK, http.StatusNotModified))
+		require.NoError(t, err)
+		resp, err := client.Do(req, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		req, err = client.NewRequest(http.MethodGet, "created", nil, WithExpectedStatus(http.StatusOK))
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		require.Equal(t, http.StatusCreated, httpErr.StatusCode)
+		require.Equal(t, `{"id": 1}`, string(httpErr.Raw))
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		type Item struct {
+			XMLName xml.Name `xml:"item"`
+			Name    string   `xml:"name"`
+		}
+		req, err := client.NewRequest(http.MethodPost, "xml", Item{Name: "a"}, WithCodec(xmlCodec{}))
+		require.NoError(t, err)
+		var v Item
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, "a", v.Name)
+	})
+}
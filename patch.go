@@ -0,0 +1,244 @@
+package jsonclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// JSONPatchContentType is the content type of a JSON Patch document (RFC 6902)
+	JSONPatchContentType = "application/json-patch+json"
+	// MergePatchContentType is the content type of a JSON Merge Patch document (RFC 7396)
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+// ContentTyper could be implemented by a request body to set a content type
+// different from `application/json`.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// JSON Patch operations
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpMove    = "move"
+	PatchOpCopy    = "copy"
+	PatchOpTest    = "test"
+)
+
+// JSONPatchOperation is a single operation of a JSON Patch document.
+// Path and From are JSON pointers (RFC 6901).
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON always includes the value for the operations that require it,
+// also if it is the zero value.
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	op := map[string]interface{}{
+		"op":   o.Op,
+		"path": o.Path,
+	}
+	switch o.Op {
+	case PatchOpAdd, PatchOpReplace, PatchOpTest:
+		op["value"] = o.Value
+	case PatchOpMove, PatchOpCopy:
+		op["from"] = o.From
+	}
+	return json.Marshal(op)
+}
+
+// JSONPatch is a JSON Patch document (RFC 6902). If used as request body, it is
+// sent with `application/json-patch+json` content type.
+type JSONPatch []JSONPatchOperation
+
+// ContentType of the JSON Patch document
+func (JSONPatch) ContentType() string {
+	return JSONPatchContentType
+}
+
+// MergePatch is a JSON Merge Patch document (RFC 7396). If used as request body,
+// it is sent with `application/merge-patch+json` content type.
+// A nil value removes the key from the target document.
+type MergePatch map[string]interface{}
+
+// ContentType of the JSON Merge Patch document
+func (MergePatch) ContentType() string {
+	return MergePatchContentType
+}
+
+// DiffJSONPatch generates the JSON Patch that transforms original into modified.
+// Both values are compared using their JSON representation.
+func DiffJSONPatch(original, modified interface{}) (JSONPatch, error) {
+	o, err := toJSONValue(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toJSONValue(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := JSONPatch{}
+	diffJSONPatch(&patch, "", o, m)
+	return patch, nil
+}
+
+func diffJSONPatch(patch *JSONPatch, path string, original, modified interface{}) {
+	if reflect.DeepEqual(original, modified) {
+		return
+	}
+
+	switch o := original.(type) {
+	case map[string]interface{}:
+		m, ok := modified.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(o) {
+			keyPath := path + "/" + escapeJSONPointer(key)
+			if mv, ok := m[key]; ok {
+				diffJSONPatch(patch, keyPath, o[key], mv)
+			} else {
+				*patch = append(*patch, JSONPatchOperation{Op: PatchOpRemove, Path: keyPath})
+			}
+		}
+		for _, key := range sortedKeys(m) {
+			if _, ok := o[key]; !ok {
+				*patch = append(*patch, JSONPatchOperation{Op: PatchOpAdd, Path: path + "/" + escapeJSONPointer(key), Value: m[key]})
+			}
+		}
+		return
+	case []interface{}:
+		m, ok := modified.([]interface{})
+		if !ok {
+			break
+		}
+		common := len(o)
+		if len(m) < common {
+			common = len(m)
+		}
+		for i := 0; i < common; i++ {
+			diffJSONPatch(patch, path+"/"+strconv.Itoa(i), o[i], m[i])
+		}
+		for i := len(o) - 1; i >= common; i-- {
+			*patch = append(*patch, JSONPatchOperation{Op: PatchOpRemove, Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(m); i++ {
+			*patch = append(*patch, JSONPatchOperation{Op: PatchOpAdd, Path: path + "/-", Value: m[i]})
+		}
+		return
+	}
+
+	*patch = append(*patch, JSONPatchOperation{Op: PatchOpReplace, Path: path, Value: modified})
+}
+
+// DiffMergePatch generates the JSON Merge Patch that transforms original into
+// modified. Both values must be represented as JSON objects.
+// Since in a Merge Patch a null value removes a key, keys that are set to null
+// in modified are removed from the target.
+func DiffMergePatch(original, modified interface{}) (MergePatch, error) {
+	o, err := toJSONValue(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toJSONValue(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	oObj, ok := o.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("merge patch: original is not a json object")
+	}
+	mObj, ok := m.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("merge patch: modified is not a json object")
+	}
+	return diffMergePatch(oObj, mObj), nil
+}
+
+func diffMergePatch(original, modified map[string]interface{}) MergePatch {
+	patch := MergePatch{}
+	for key := range original {
+		if _, ok := modified[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, mv := range modified {
+		ov, ok := original[key]
+		if ok && reflect.DeepEqual(ov, mv) {
+			continue
+		}
+		oObj, oIsObj := ov.(map[string]interface{})
+		mObj, mIsObj := mv.(map[string]interface{})
+		if ok && oIsObj && mIsObj {
+			patch[key] = map[string]interface{}(diffMergePatch(oObj, mObj))
+			continue
+		}
+		patch[key] = mv
+	}
+	return patch
+}
+
+// toJSONValue converts v to its generic JSON representation.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapeJSONPointer(token string) string {
+	return jsonPointerEscaper.Replace(token)
+}
+
+// NewJSONPatchRequestWithContext creates a PATCH request with, as body, the JSON
+// Patch that transforms original into modified.
+func (c *Client) NewJSONPatchRequestWithContext(ctx context.Context, urlStr string, original, modified interface{}, opts ...RequestOption) (*http.Request, error) {
+	patch, err := DiffJSONPatch(original, modified)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewRequestWithContext(ctx, http.MethodPatch, urlStr, patch, opts...)
+}
+
+// NewMergePatchRequestWithContext creates a PATCH request with, as body, the
+// JSON Merge Patch that transforms original into modified.
+func (c *Client) NewMergePatchRequestWithContext(ctx context.Context, urlStr string, original, modified interface{}, opts ...RequestOption) (*http.Request, error) {
+	patch, err := DiffMergePatch(original, modified)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewRequestWithContext(ctx, http.MethodPatch, urlStr, patch, opts...)
+}
@@ -0,0 +1,208 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPatchOperation(t *testing.T) {
+	t.Run("marshal value also if zero value", func(t *testing.T) {
+		data, err := json.Marshal(JSONPatch{
+			{Op: PatchOpReplace, Path: "/enabled", Value: false},
+			{Op: PatchOpAdd, Path: "/nullable", Value: nil},
+			{Op: PatchOpRemove, Path: "/a~1b"},
+			{Op: PatchOpMove, Path: "/to", From: "/from"},
+		})
+		require.NoError(t, err)
+		require.JSONEq(t, `[
+			{"op":"replace","path":"/enabled","value":false},
+			{"op":"add","path":"/nullable","value":null},
+			{"op":"remove","path":"/a~1b"},
+			{"op":"move","path":"/to","from":"/from"}
+		]`, string(data))
+	})
+
+	t.Run("unmarshal patch", func(t *testing.T) {
+		var patch JSONPatch
+		err := json.Unmarshal([]byte(`[{"op":"copy","path":"/a","from":"/b"}]`), &patch)
+		require.NoError(t, err)
+		require.Equal(t, JSONPatch{{Op: PatchOpCopy, Path: "/a", From: "/b"}}, patch)
+	})
+}
+
+func TestDiffJSONPatch(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type User struct {
+		Name    string            `json:"name"`
+		Age     int               `json:"age"`
+		Tags    []string          `json:"tags"`
+		Address *Address          `json:"address,omitempty"`
+		Labels  map[string]string `json:"labels,omitempty"`
+	}
+
+	t.Run("returns empty patch if values are equal", func(t *testing.T) {
+		patch, err := DiffJSONPatch(User{Name: "a"}, User{Name: "a"})
+		require.NoError(t, err)
+		require.Equal(t, JSONPatch{}, patch)
+	})
+
+	t.Run("generates add, remove and replace operations", func(t *testing.T) {
+		original := User{
+			Name:    "john",
+			Age:     30,
+			Tags:    []string{"a", "b", "c"},
+			Address: &Address{City: "Rome"},
+		}
+		modified := User{
+			Name:   "john",
+			Age:    31,
+			Tags:   []string{"a", "x"},
+			Labels: map[string]string{"a/b": "c"},
+		}
+
+		patch, err := DiffJSONPatch(original, modified)
+		require.NoError(t, err)
+		require.Equal(t, JSONPatch{
+			{Op: PatchOpRemove, Path: "/address"},
+			{Op: PatchOpReplace, Path: "/age", Value: json.Number("31")},
+			{Op: PatchOpReplace, Path: "/tags/1", Value: "x"},
+			{Op: PatchOpRemove, Path: "/tags/2"},
+			{Op: PatchOpAdd, Path: "/labels", Value: map[string]interface{}{"a/b": "c"}},
+		}, patch)
+	})
+
+	t.Run("append items to arrays", func(t *testing.T) {
+		patch, err := DiffJSONPatch([]int{1}, []int{1, 2, 3})
+		require.NoError(t, err)
+		require.Equal(t, JSONPatch{
+			{Op: PatchOpAdd, Path: "/-", Value: json.Number("2")},
+			{Op: PatchOpAdd, Path: "/-", Value: json.Number("3")},
+		}, patch)
+	})
+
+	t.Run("escape json pointer tokens", func(t *testing.T) {
+		patch, err := DiffJSONPatch(map[string]int{"a/b": 1, "c~d": 1}, map[string]int{"a/b": 2})
+		require.NoError(t, err)
+		require.Equal(t, JSONPatch{
+			{Op: PatchOpReplace, Path: "/a~1b", Value: json.Number("2")},
+			{Op: PatchOpRemove, Path: "/c~0d"},
+		}, patch)
+	})
+
+	t.Run("replace root if types are different", func(t *testing.T) {
+		patch, err := DiffJSONPatch([]int{1}, map[string]int{"a": 1})
+		require.NoError(t, err)
+		require.Equal(t, JSONPatch{
+			{Op: PatchOpReplace, Path: "", Value: map[string]interface{}{"a": json.Number("1")}},
+		}, patch)
+	})
+
+	t.Run("throws if value is not serializable", func(t *testing.T) {
+		_, err := DiffJSONPatch(make(chan int), nil)
+		require.Error(t, err)
+	})
+}
+
+func TestDiffMergePatch(t *testing.T) {
+	t.Run("generates nested merge patch", func(t *testing.T) {
+		original := map[string]interface{}{
+			"title": "Goodbye!",
+			"author": map[string]interface{}{
+				"givenName":  "John",
+				"familyName": "Doe",
+			},
+			"tags":    []string{"example", "sample"},
+			"content": "This will be unchanged",
+		}
+		modified := map[string]interface{}{
+			"title": "Hello!",
+			"author": map[string]interface{}{
+				"givenName": "John",
+			},
+			"tags":        []string{"example"},
+			"content":     "This will be unchanged",
+			"phoneNumber": "+01-123-456-7890",
+		}
+
+		patch, err := DiffMergePatch(original, modified)
+		require.NoError(t, err)
+
+		data, err := json.Marshal(patch)
+		require.NoError(t, err)
+		require.JSONEq(t, `{
+			"title": "Hello!",
+			"phoneNumber": "+01-123-456-7890",
+			"author": {"familyName": null},
+			"tags": ["example"]
+		}`, string(data))
+	})
+
+	t.Run("throws if values are not objects", func(t *testing.T) {
+		_, err := DiffMergePatch([]int{}, map[string]int{})
+		require.EqualError(t, err, "merge patch: original is not a json object")
+
+		_, err = DiffMergePatch(map[string]int{}, "string")
+		require.EqualError(t, err, "merge patch: modified is not a json object")
+	})
+}
+
+func TestPatchRequests(t *testing.T) {
+	client, err := New(Options{
+		BaseURL: apiURL,
+		Headers: Headers{"Content-Type": "not-a-json"},
+	})
+	require.NoError(t, err, "create client error")
+
+	original := map[string]interface{}{"name": "a", "age": 1}
+	modified := map[string]interface{}{"name": "b", "age": 1}
+
+	t.Run("json patch request", func(t *testing.T) {
+		req, err := client.NewJSONPatchRequestWithContext(context.Background(), "my-resource", original, modified)
+		require.NoError(t, err)
+
+		require.Equal(t, http.MethodPatch, req.Method)
+		require.Equal(t, JSONPatchContentType, req.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"op":"replace","path":"/name","value":"b"}]`, string(body))
+	})
+
+	t.Run("merge patch request", func(t *testing.T) {
+		req, err := client.NewMergePatchRequestWithContext(context.Background(), "my-resource", original, modified)
+		require.NoError(t, err)
+
+		require.Equal(t, http.MethodPatch, req.Method)
+		require.Equal(t, MergePatchContentType, req.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"name":"b"}`, string(body))
+	})
+
+	t.Run("hand-crafted patch keeps content type", func(t *testing.T) {
+		req, err := client.NewRequest(http.MethodPatch, "my-resource", MergePatch{"name": nil})
+		require.NoError(t, err)
+
+		require.Equal(t, MergePatchContentType, req.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.Equal(t, `{"name":null}`, strings.TrimSpace(string(body)))
+	})
+
+	t.Run("throws if diff fails", func(t *testing.T) {
+		req, err := client.NewMergePatchRequestWithContext(context.Background(), "my-resource", []int{}, modified)
+		require.Error(t, err)
+		require.Nil(t, req)
+
+		req, err = client.NewJSONPatchRequestWithContext(context.Background(), "my-resource", make(chan int), modified)
+		require.Error(t, err)
+		require.Nil(t, req)
+	})
+}
@@ -0,0 +1,140 @@
+package jsonclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const pinPrefix = "sha256/"
+
+// ErrPinMismatch define a server certificate chain without any pinned public
+// key.
+var ErrPinMismatch = errors.New("certificate pin mismatch")
+
+// PinningConfig struct define the SHA-256 SPKI pins of the servers: at least
+// a certificate of the chain (the leaf, an intermediate or the root) must
+// have one of the pinned public keys. The pins are the base64 encoded sha256
+// hashes of the DER encoded SubjectPublicKeyInfo, optionally prefixed with
+// `sha256/`, e.g. generated with:
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+type PinningConfig struct {
+	Pins []string
+	// BackupPins are accepted as Pins, e.g. the keys of the next certificate
+	// not yet deployed.
+	BackupPins []string
+	// ReportOnly does not fail the connections on pin mismatch, but only
+	// calls OnMismatch.
+	ReportOnly bool
+	// OnMismatch, if set, is called on each pin mismatch.
+	OnMismatch func(err *PinError)
+}
+
+// PinError struct define a connection to a server whose certificate chain
+// does not match the pins. ServerName is the name sent as SNI (empty for ip
+// addresses), and Chain contains the pins of the certificates of the chain.
+type PinError struct {
+	ServerName string
+	Chain      []string
+	Err        error
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("%s for %s: chain pins %s", e.Err, e.ServerName, strings.Join(e.Chain, ", "))
+}
+
+func (e *PinError) Unwrap() error {
+	return e.Err
+}
+
+type pinner struct {
+	pins       map[string]bool
+	reportOnly bool
+	onMismatch func(err *PinError)
+}
+
+func newPinner(config PinningConfig) (*pinner, error) {
+	p := &pinner{
+		pins:       map[string]bool{},
+		reportOnly: config.ReportOnly,
+		onMismatch: config.OnMismatch,
+	}
+	for _, pin := range append(append([]string{}, config.Pins...), config.BackupPins...) {
+		pin = strings.TrimPrefix(pin, pinPrefix)
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid pin %q", pin)
+		}
+		p.pins[pin] = true
+	}
+	if len(p.pins) == 0 {
+		return nil, fmt.Errorf("pinning without pins")
+	}
+	return p, nil
+}
+
+// configure sets the pins verification in the tls configuration of the
+// transport, after the other verifications.
+func (p *pinner) configure(transport *http.Transport) {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	verify := transport.TLSClientConfig.VerifyConnection
+	transport.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		return p.verify(cs)
+	}
+}
+
+// verify checks the pins against the verified chains only: the peer
+// certificates are sent by the server, so any certificate could be appended
+// to them. Without verified chains, i.e. with InsecureSkipVerify, only the
+// leaf certificate is checked.
+func (p *pinner) verify(cs tls.ConnectionState) error {
+	var certs []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		certs = cs.PeerCertificates[:1]
+	}
+
+	seen := map[string]bool{}
+	var chain []string
+	for _, cert := range certs {
+		pin := SPKIPin(cert)
+		if p.pins[pin] {
+			return nil
+		}
+		if !seen[pin] {
+			seen[pin] = true
+			chain = append(chain, pin)
+		}
+	}
+
+	err := &PinError{ServerName: cs.ServerName, Chain: chain, Err: ErrPinMismatch}
+	if p.onMismatch != nil {
+		p.onMismatch(err)
+	}
+	if p.reportOnly {
+		return nil
+	}
+	return err
+}
+
+// SPKIPin returns the base64 encoded sha256 hash of the SubjectPublicKeyInfo
+// of the certificate.
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,153 @@
+package jsonclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	serverPin := SPKIPin(server.Certificate())
+	otherHash := sha256.Sum256([]byte("other"))
+	otherPin := base64.StdEncoding.EncodeToString(otherHash[:])
+
+	get := func(t *testing.T, pinning PinningConfig) error {
+		t.Helper()
+		client, err := New(Options{BaseURL: server.URL, HTTPClient: server.Client(), Pinning: &pinning})
+		require.NoError(t, err)
+		req, err := client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		return err
+	}
+
+	t.Run("accepts pinned and backup keys", func(t *testing.T) {
+		require.NoError(t, get(t, PinningConfig{Pins: []string{"sha256/" + serverPin}}))
+		require.NoError(t, get(t, PinningConfig{Pins: []string{otherPin}, BackupPins: []string{serverPin}}))
+	})
+
+	t.Run("rejects not pinned keys with a typed error", func(t *testing.T) {
+		var reported []*PinError
+		err := get(t, PinningConfig{Pins: []string{otherPin}, OnMismatch: func(err *PinError) {
+			reported = append(reported, err)
+		}})
+		var pinErr *PinError
+		require.True(t, errors.As(err, &pinErr))
+		require.ErrorIs(t, err, ErrPinMismatch)
+		require.Equal(t, []string{serverPin}, pinErr.Chain)
+		require.Len(t, reported, 1)
+
+		var certErr *tls.CertificateVerificationError
+		require.False(t, errors.As(err, &certErr))
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		var reported []*PinError
+		require.NoError(t, get(t, PinningConfig{Pins: []string{otherPin}, ReportOnly: true, OnMismatch: func(err *PinError) {
+			reported = append(reported, err)
+		}}))
+		require.Len(t, reported, 1)
+		require.Equal(t, []string{serverPin}, reported[0].Chain)
+	})
+
+	t.Run("works with the tls option", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+		client, err := New(Options{
+			BaseURL: server.URL,
+			TLS:     &TLSConfig{CAFiles: []string{caFile}},
+			Pinning: &PinningConfig{Pins: []string{otherPin}},
+		})
+		require.NoError(t, err)
+		req, err := client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.ErrorIs(t, err, ErrPinMismatch)
+	})
+
+	t.Run("ignores pinned certificates out of the verified chain", func(t *testing.T) {
+		// the server presents a trusted certificate, appending the pinned
+		// one which does not sign it
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "127.0.0.1"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+
+		unrelated := httptest.NewUnstartedServer(server.Config.Handler)
+		unrelated.TLS = &tls.Config{Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der, server.Certificate().Raw},
+			PrivateKey:  key,
+		}}}
+		unrelated.StartTLS()
+		defer unrelated.Close()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		client, err := New(Options{BaseURL: unrelated.URL, HTTPClient: httpClient, Pinning: &PinningConfig{Pins: []string{serverPin}}})
+		require.NoError(t, err)
+		req, err := client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		var pinErr *PinError
+		require.True(t, errors.As(err, &pinErr))
+		require.Equal(t, []string{SPKIPin(cert)}, pinErr.Chain)
+	})
+
+	t.Run("checks the leaf without verified chains", func(t *testing.T) {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		client, err := New(Options{BaseURL: server.URL, HTTPClient: httpClient, Pinning: &PinningConfig{Pins: []string{serverPin}}})
+		require.NoError(t, err)
+		req, err := client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := New(Options{Pinning: &PinningConfig{}})
+		require.EqualError(t, err, "pinning without pins")
+
+		_, err = New(Options{Pinning: &PinningConfig{Pins: []string{"c2hvcnQ="}}})
+		require.EqualError(t, err, `invalid pin "c2hvcnQ="`)
+	})
+}
+
+func TestSPKIPin(t *testing.T) {
+	cert := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("spki")}
+	hash := sha256.Sum256([]byte("spki"))
+	require.Equal(t, base64.StdEncoding.EncodeToString(hash[:]), SPKIPin(cert))
+}
@@ -0,0 +1,283 @@
+package jsonclient
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newHTTPProxy starts a forward proxy requiring the basic credentials, which
+// counts the proxied requests and tunnels the CONNECT ones.
+func newHTTPProxy(t *testing.T, username, password string, calls *int64) *httptest.Server {
+	t.Helper()
+	expectedAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Proxy-Authorization") != expectedAuth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		atomic.AddInt64(calls, 1)
+
+		if req.Method == http.MethodConnect {
+			target, err := net.Dial("tcp", req.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				target.Close()
+				return
+			}
+			pipe(conn, target)
+			return
+		}
+
+		outReq, _ := http.NewRequest(req.Method, req.URL.String(), req.Body)
+		resp, err := http.DefaultTransport.RoundTrip(outReq)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// newSOCKS5Proxy starts a SOCKS5 proxy requiring the username/password
+// authentication, which counts the proxied connections.
+func newSOCKS5Proxy(t *testing.T, username, password string, calls *int64) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				target, err := socks5Handshake(conn, username, password)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				atomic.AddInt64(calls, 1)
+				pipe(conn, target)
+			}()
+		}
+	}()
+	return listener
+}
+
+func socks5Handshake(conn net.Conn, username, password string) (net.Conn, error) {
+	// greeting: version, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return nil, err
+	}
+	conn.Write([]byte{5, 2})
+
+	// username/password authentication (RFC 1929)
+	readString := func() (string, error) {
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		s := make([]byte, length[0])
+		_, err := io.ReadFull(conn, s)
+		return string(s), err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+		return nil, err
+	}
+	user, err := readString()
+	if err != nil {
+		return nil, err
+	}
+	pass, err := readString()
+	if err != nil {
+		return nil, err
+	}
+	if user != username || pass != password {
+		conn.Write([]byte{1, 1})
+		return nil, io.EOF
+	}
+	conn.Write([]byte{1, 0})
+
+	// connect request
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		if host, err = readString(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, io.EOF
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+	if host == "localhost" {
+		host = "127.0.0.1"
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return target, nil
+}
+
+func pipe(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+	io.Copy(b, a)
+	b.Close()
+}
+
+func TestProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer target.Close()
+	tlsTarget := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer tlsTarget.Close()
+
+	get := func(t *testing.T, baseURL string, httpClient *http.Client, proxy ProxyConfig) error {
+		t.Helper()
+		client, err := New(Options{BaseURL: baseURL, HTTPClient: httpClient, Proxy: &proxy})
+		require.NoError(t, err)
+		req, err := client.NewRequest(http.MethodGet, "resource", nil)
+		require.NoError(t, err)
+		var v map[string]bool
+		if _, err := client.Do(req, &v); err != nil {
+			return err
+		}
+		require.True(t, v["ok"])
+		return nil
+	}
+
+	t.Run("http proxy with basic auth", func(t *testing.T) {
+		var calls int64
+		proxy := newHTTPProxy(t, "user", "pa ss", &calls)
+		proxyURL, _ := url.Parse(proxy.URL)
+		proxyURL.User = url.UserPassword("user", "pa ss")
+
+		require.NoError(t, get(t, target.URL, nil, ProxyConfig{URL: proxyURL.String()}))
+		require.NoError(t, get(t, tlsTarget.URL, tlsTarget.Client(), ProxyConfig{URL: proxyURL.String()}))
+		require.EqualValues(t, 2, atomic.LoadInt64(&calls))
+
+		proxyURL.User = url.UserPassword("user", "wrong")
+		err := get(t, target.URL, nil, ProxyConfig{URL: proxyURL.String()})
+		require.ErrorIs(t, err, ErrHTTP)
+		require.ErrorContains(t, err, "407")
+	})
+
+	t.Run("socks5 proxy with username and password", func(t *testing.T) {
+		var calls int64
+		listener := newSOCKS5Proxy(t, "user", "pass", &calls)
+
+		require.NoError(t, get(t, target.URL, nil, ProxyConfig{URL: "socks5://user:pass@" + listener.Addr().String()}))
+		require.NoError(t, get(t, tlsTarget.URL, tlsTarget.Client(), ProxyConfig{URL: "socks5h://user:pass@" + listener.Addr().String()}))
+		require.EqualValues(t, 2, atomic.LoadInt64(&calls))
+
+		require.Error(t, get(t, target.URL, nil, ProxyConfig{URL: "socks5://user:wrong@" + listener.Addr().String()}))
+		require.EqualValues(t, 2, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("no proxy", func(t *testing.T) {
+		var calls int64
+		proxy := newHTTPProxy(t, "user", "pass", &calls)
+		proxyURL := "http://user:pass@" + proxy.Listener.Addr().String()
+
+		require.NoError(t, get(t, target.URL, nil, ProxyConfig{URL: proxyURL, NoProxy: []string{"127.0.0.0/8"}}))
+		require.Zero(t, atomic.LoadInt64(&calls))
+		require.NoError(t, get(t, target.URL, nil, ProxyConfig{URL: proxyURL, NoProxy: []string{"127.0.0.1:1"}}))
+		require.EqualValues(t, 1, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := New(Options{Proxy: &ProxyConfig{URL: "ftp://proxy"}})
+		require.EqualError(t, err, "unsupported proxy scheme: ftp")
+
+		_, err = New(Options{Proxy: &ProxyConfig{URL: "http://"}})
+		require.EqualError(t, err, "proxy url without host")
+
+		_, err = New(Options{Proxy: &ProxyConfig{NoProxy: []string{" "}}})
+		require.EqualError(t, err, "empty no proxy rule")
+
+		_, err = New(Options{UnixSocket: "/tmp/a.sock", Proxy: &ProxyConfig{}})
+		require.EqualError(t, err, "unix socket and proxy cannot be both set")
+	})
+}
+
+func TestProxySelectorNoProxy(t *testing.T) {
+	p, err := newProxySelector(ProxyConfig{
+		URL:     "http://proxy:3128",
+		NoProxy: []string{"example.com", ".internal", "10.0.0.0/8", "192.168.1.1", "api.test:8443"},
+	})
+	require.NoError(t, err)
+
+	for rawURL, noProxy := range map[string]bool{
+		"http://example.com/":       true,
+		"http://a.example.com/":     true,
+		"http://notexample.com/":    false,
+		"http://internal/":          false,
+		"http://svc.internal/":      true,
+		"http://10.1.2.3/":          true,
+		"http://11.1.2.3/":          false,
+		"https://192.168.1.1/":      true,
+		"https://api.test:8443/":    true,
+		"https://api.test/":         false,
+		"http://Example.COM:8080/a": true,
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		require.Equal(t, noProxy, p.isNoProxy(u), rawURL)
+
+		proxyURL, err := p.proxy(&http.Request{URL: u})
+		require.NoError(t, err)
+		require.Equal(t, noProxy, proxyURL == nil, rawURL)
+	}
+
+	all, err := newProxySelector(ProxyConfig{NoProxy: []string{"*"}})
+	require.NoError(t, err)
+	proxyURL, err := all.proxy(&http.Request{URL: &url.URL{Scheme: "http", Host: "example.com"}})
+	require.NoError(t, err)
+	require.Nil(t, proxyURL)
+}
@@ -0,0 +1,88 @@
+package jsonclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// hostServerNames maps the addresses dialed for the https base urls to the
+// host, without port, used as their TLS server name.
+func hostServerNames(host string, baseURLs []string) map[string]string {
+	serverName := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		serverName = h
+	}
+	serverNames := map[string]string{}
+	for _, rawURL := range baseURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Scheme != "https" {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		serverNames[net.JoinHostPort(strings.ToLower(u.Hostname()), port)] = serverName
+	}
+	return serverNames
+}
+
+// parseResolve validates the resolve mapping, returning it with normalized
+// keys and addresses.
+func parseResolve(resolve map[string][]string) (map[string][]string, error) {
+	parsed := make(map[string][]string, len(resolve))
+	for hostPort, addrs := range resolve {
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil || host == "" || port == "" {
+			return nil, fmt.Errorf("invalid resolve host %q: expected host:port", hostPort)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("resolve host %q without addresses", hostPort)
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+			if ip == nil {
+				return nil, fmt.Errorf("invalid resolve address %q for %q", addr, hostPort)
+			}
+			key := net.JoinHostPort(strings.ToLower(host), port)
+			parsed[key] = append(parsed[key], net.JoinHostPort(ip.String(), port))
+		}
+	}
+	return parsed, nil
+}
+
+// resolveDialer configures the transport to dial the addresses of the
+// resolve mapping, in order until one succeeds, instead of resolving the
+// hosts in the mapping.
+func resolveDialer(resolve map[string][]string) func(*http.Transport) {
+	return func(transport *http.Transport) {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			addrs, ok := resolve[strings.ToLower(addr)]
+			if !ok {
+				return dial(ctx, network, addr)
+			}
+			var firstErr error
+			for _, resolved := range addrs {
+				conn, err := dial(ctx, network, resolved)
+				if err == nil {
+					return conn, nil
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			}
+			return nil, firstErr
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package jsonclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostAsServerName(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"host": "` + req.Host + `", "sni": "` + req.TLS.ServerName + `"}`))
+	}))
+	defer server.Close()
+
+	type Response struct {
+		Host string `json:"host"`
+		SNI  string `json:"sni"`
+	}
+	get := func(t *testing.T, opts Options) (Response, error) {
+		t.Helper()
+		opts.HTTPClient = server.Client()
+		client, err := New(opts)
+		require.NoError(t, err)
+		req, err := client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		var v Response
+		_, err = client.Do(req, &v)
+		return v, err
+	}
+
+	t.Run("drives host, sni and verification", func(t *testing.T) {
+		v, err := get(t, Options{BaseURL: server.URL, Host: "example.com", HostAsServerName: true})
+		require.NoError(t, err)
+		require.Equal(t, Response{Host: "example.com", SNI: "example.com"}, v)
+
+		v, err = get(t, Options{BaseURL: server.URL, Host: "example.com:8443", HostAsServerName: true})
+		require.NoError(t, err)
+		require.Equal(t, Response{Host: "example.com:8443", SNI: "example.com"}, v)
+
+		_, err = get(t, Options{BaseURL: server.URL, Host: "other.com", HostAsServerName: true})
+		require.ErrorContains(t, err, "other.com")
+	})
+
+	t.Run("only for the base url", func(t *testing.T) {
+		shadowSNI := make(chan string, 1)
+		other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("X-Shadow") != "" {
+				shadowSNI <- req.TLS.ServerName
+			}
+			w.Write([]byte(`{"host": "` + req.Host + `", "sni": "` + req.TLS.ServerName + `"}`))
+		}))
+		defer other.Close()
+
+		client, err := New(Options{
+			BaseURL:          server.URL,
+			HTTPClient:       server.Client(),
+			Host:             "example.com",
+			HostAsServerName: true,
+			Shadow:           &ShadowTraffic{BaseURL: other.URL, Percentage: 100},
+		})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, other.URL, nil)
+		require.NoError(t, err)
+		var v Response
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Empty(t, v.SNI)
+
+		req, err = client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Shadow", "true")
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, "example.com", v.SNI)
+		require.Empty(t, <-shadowSNI)
+	})
+
+	t.Run("host only sets the header", func(t *testing.T) {
+		v, err := get(t, Options{BaseURL: server.URL, Host: "other.com"})
+		require.NoError(t, err)
+		require.Equal(t, Response{Host: "other.com"}, v)
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		u, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		hostPort := "example.com:" + u.Port()
+
+		v, err := get(t, Options{
+			BaseURL: "https://" + hostPort,
+			Resolve: map[string][]string{"Example.com:" + u.Port(): {"[::1]", "127.0.0.1"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, Response{Host: hostPort, SNI: "example.com"}, v)
+
+		_, err = get(t, Options{
+			BaseURL: "https://" + hostPort,
+			Resolve: map[string][]string{hostPort: {"127.0.0.2"}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := New(Options{HostAsServerName: true})
+		require.EqualError(t, err, "host as server name without host")
+
+		_, err = New(Options{Host: "a", HostAsServerName: true, TLS: &TLSConfig{ServerName: "b"}})
+		require.EqualError(t, err, "host as server name and tls server name cannot be both set")
+
+		_, err = New(Options{Resolve: map[string][]string{"example.com": {"127.0.0.1"}}})
+		require.EqualError(t, err, `invalid resolve host "example.com": expected host:port`)
+
+		_, err = New(Options{Resolve: map[string][]string{"example.com:443": {}}})
+		require.EqualError(t, err, `resolve host "example.com:443" without addresses`)
+
+		_, err = New(Options{Resolve: map[string][]string{"example.com:443": {"host"}}})
+		require.EqualError(t, err, `invalid resolve address "host" for "example.com:443"`)
+	})
+}
@@ -0,0 +1,101 @@
+package jsonclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// shouldRetry reports whether the attempt should be retried: the request must
+// be safe to send again and the attempt must have failed with a transport
+// error or with a 429, 502, 503 or 504 status code.
+func (p *RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if !isRetryable(req) {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay returns the delay before the retry following the attempt (starting
+// from 1), preferring the Retry-After header of the response.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	delay, ok := retryAfter(resp)
+	if !ok {
+		delay = p.Backoff
+		if delay <= 0 {
+			delay = defaultRetryBackoff
+		}
+		for i := 1; i < attempt && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); i++ {
+			delay *= 2
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// sendWithRetry sends the request, retrying it as configured by the retry
+// policy of the request, if any. Requests with a body are retried only if it
+// could be replayed, and every attempt keeps the same headers, including the
+// Idempotency-Key.
+func (c *Client) sendWithRetry(req *http.Request) (*http.Response, error) {
+	cfg := requestConfigFrom(req)
+	if cfg == nil || cfg.retry == nil || cfg.retry.MaxAttempts < 2 || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return c.send(req)
+	}
+	policy := cfg.retry
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(req)
+		if attempt >= policy.MaxAttempts || streamError(req) != nil || !policy.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		delay := policy.delay(attempt, resp)
+		if resp != nil {
+			drainAndClose(resp.Body)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req, err = cloneWithBody(req); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package jsonclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	failures := 0
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		if failures > 0 {
+			failures--
+			if req.URL.Path != "/wait" {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	reset := func(f, s int) {
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = nil
+		failures = f
+		status = s
+	}
+	sent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, bodies...)
+	}
+
+	client, err := New(Options{BaseURL: server.URL})
+	require.NoError(t, err)
+	policy := WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	t.Run("retries the idempotent requests", func(t *testing.T) {
+		reset(2, http.StatusServiceUnavailable)
+		req, err := client.NewRequest(http.MethodPut, "items/1", map[string]int{"a": 1}, policy)
+		require.NoError(t, err)
+		var v map[string]int
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"id": 1}, v)
+		require.Equal(t, []string{"{\"a\":1}\n", "{\"a\":1}\n", "{\"a\":1}\n"}, sent())
+	})
+
+	t.Run("stops after the max attempts", func(t *testing.T) {
+		reset(5, http.StatusBadGateway)
+		req, err := client.NewRequest(http.MethodGet, "items", nil, policy)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		var httpErr *HTTPError
+		require.ErrorAs(t, err, &httpErr)
+		require.Equal(t, http.StatusBadGateway, httpErr.StatusCode)
+		require.Len(t, sent(), 3)
+	})
+
+	t.Run("does not retry unsafe requests without key", func(t *testing.T) {
+		reset(2, http.StatusServiceUnavailable)
+		req, err := client.NewRequest(http.MethodPost, "items", map[string]int{"a": 1}, policy)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.Error(t, err)
+		require.Len(t, sent(), 1)
+	})
+
+	t.Run("does not retry other statuses or without policy", func(t *testing.T) {
+		reset(2, http.StatusInternalServerError)
+		req, err := client.NewRequest(http.MethodGet, "items", nil, policy)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.Error(t, err)
+		require.Len(t, sent(), 1)
+
+		reset(2, http.StatusServiceUnavailable)
+		req, err = client.NewRequest(http.MethodGet, "items", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		require.Error(t, err)
+		require.Len(t, sent(), 1)
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		reset(2, http.StatusServiceUnavailable)
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour})
+		req, err := client.NewRequestWithContext(ctx, http.MethodGet, "wait", nil, slow)
+		require.NoError(t, err)
+		errs := make(chan error, 1)
+		go func() {
+			_, err := client.Do(req, nil)
+			errs <- err
+		}()
+		require.Eventually(t, func() bool { return len(sent()) == 1 }, time.Second, time.Millisecond)
+		cancel()
+		require.ErrorIs(t, <-errs, context.Canceled)
+	})
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+	require.Equal(t, 10*time.Millisecond, policy.delay(1, nil))
+	require.Equal(t, 20*time.Millisecond, policy.delay(2, nil))
+	require.Equal(t, 30*time.Millisecond, policy.delay(3, nil))
+	require.Equal(t, defaultRetryBackoff, (&RetryPolicy{}).delay(1, nil))
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"1"}}}
+	require.Equal(t, 30*time.Millisecond, policy.delay(1, resp))
+	require.Equal(t, time.Second, (&RetryPolicy{}).delay(1, resp))
+}
@@ -0,0 +1,258 @@
+package jsonclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const defaultCSRFHeader = "X-CSRF-Token"
+
+// ErrSessionExpired define a response of an expired session.
+var ErrSessionExpired = errors.New("session expired")
+
+// SessionConfig struct define how a Session logs in and detects expired
+// sessions.
+type SessionConfig struct {
+	// Login creates the login request, sent with the client. Its response
+	// must set the session cookies.
+	Login func(ctx context.Context, client *Client) (*http.Request, error)
+	// CSRFCookie is the name of the cookie holding the CSRF token, e.g.
+	// `XSRF-TOKEN`.
+	CSRFCookie string
+	// CSRFResponseHeader is the response header holding the CSRF token, e.g.
+	// `X-CSRF-Token`.
+	CSRFResponseHeader string
+	// CSRFHeader is the request header echoing the CSRF token. Default to
+	// `X-CSRF-Token`.
+	CSRFHeader string
+	// LoginPath is the path of the login page: responses redirected to it
+	// (or to a path under it) are considered as of an expired session, while
+	// the requests sent directly to it are not.
+	LoginPath string
+	// IsExpired reports whether the response is of an expired session. By
+	// default, responses with 401 or 403 status code, or redirected to the
+	// LoginPath, are considered expired.
+	IsExpired func(resp *http.Response) bool
+}
+
+// Session struct define a cookie session of a Client, which requires a
+// CookieJar (or any http.CookieJar). The session logs in before the first
+// request and, if a request finds the session expired, logs in again and
+// retries the request once.
+type Session struct {
+	client *Client
+	config SessionConfig
+
+	mu         sync.Mutex
+	csrfToken  string
+	generation int
+	loginMu    sync.Mutex
+}
+
+type responseHookKey struct{}
+
+type requestHookKey struct{}
+
+// NewSession creates a session of the client.
+func NewSession(client *Client, config SessionConfig) (*Session, error) {
+	if client.client.Jar == nil {
+		return nil, fmt.Errorf("session requires a client with a cookie jar")
+	}
+	if config.Login == nil {
+		return nil, fmt.Errorf("session without login")
+	}
+	if config.CSRFHeader == "" {
+		config.CSRFHeader = defaultCSRFHeader
+	}
+	return &Session{client: client, config: config}, nil
+}
+
+// Login runs the login request, replacing the current session.
+func (s *Session) Login(ctx context.Context) error {
+	s.mu.Lock()
+	generation := s.generation
+	s.mu.Unlock()
+	return s.login(ctx, generation)
+}
+
+// login logs in, unless another login completed after the generation.
+func (s *Session) login(ctx context.Context, generation int) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	s.mu.Lock()
+	done := s.generation != generation
+	s.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	req, err := s.config.Login(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(context.WithValue(req.Context(), responseHookKey{}, s.captureCSRF))
+	if _, err := s.client.Do(req, nil); err != nil {
+		return fmt.Errorf("session login: %w", err)
+	}
+
+	s.mu.Lock()
+	s.generation++
+	s.mu.Unlock()
+	return nil
+}
+
+// Do works like Client.Do, sending the request within the session: it logs
+// in if needed, echoes the CSRF token and, if the session is expired, logs in
+// again and retries the request once. Requests with a body are retried only
+// if it could be replayed.
+func (s *Session) Do(req *http.Request, v interface{}) (*http.Response, error) {
+	s.mu.Lock()
+	generation := s.generation
+	s.mu.Unlock()
+	if generation == 0 {
+		if err := s.login(req.Context(), generation); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+	}
+
+	retry, err := cloneWithBody(req)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	resp, generation, err := s.do(req, v)
+	if !errors.Is(err, ErrSessionExpired) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		if retry.Body != req.Body {
+			closeBody(retry)
+		}
+		return resp, err
+	}
+
+	if err := s.login(req.Context(), generation); err != nil {
+		closeBody(retry)
+		return nil, err
+	}
+	resp, _, err = s.do(retry, v)
+	return resp, err
+}
+
+func (s *Session) do(req *http.Request, v interface{}) (*http.Response, int, error) {
+	s.mu.Lock()
+	generation := s.generation
+	s.mu.Unlock()
+
+	ctx := context.WithValue(req.Context(), responseHookKey{}, s.checkResponse)
+	ctx = context.WithValue(ctx, requestHookKey{}, s.setCSRFToken)
+	resp, err := s.client.Do(req.WithContext(ctx), v)
+	return resp, generation, err
+}
+
+// checkResponse captures the CSRF token of the response, and returns an
+// error if the session is expired.
+func (s *Session) checkResponse(resp *http.Response) error {
+	s.captureCSRF(resp)
+	isExpired := s.isExpired
+	if s.config.IsExpired != nil {
+		isExpired = s.config.IsExpired
+	}
+	if isExpired(resp) {
+		return fmt.Errorf("%w: %s %s: %d", ErrSessionExpired, resp.Request.Method, resp.Request.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *Session) isExpired(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return true
+	}
+	if s.config.LoginPath == "" {
+		return false
+	}
+	// the requests of followed redirects keep the response redirecting them
+	if resp.Request.Response != nil && isUnderPath(resp.Request.URL.Path, s.config.LoginPath) {
+		return true
+	}
+	if location, err := resp.Location(); err == nil && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return isUnderPath(location.Path, s.config.LoginPath)
+	}
+	return false
+}
+
+// isUnderPath reports whether path is base or a path under it, comparing
+// whole segments.
+func isUnderPath(path, base string) bool {
+	base = strings.TrimSuffix(base, "/")
+	return path == base || strings.HasPrefix(path, base+"/")
+}
+
+// setCSRFToken sets the CSRF header of the request, once its url is
+// resolved against the endpoint it is sent to.
+func (s *Session) setCSRFToken(req *http.Request) {
+	if token := s.token(req.URL); token != "" {
+		req.Header.Set(s.config.CSRFHeader, token)
+	}
+}
+
+func (s *Session) captureCSRF(resp *http.Response) error {
+	if s.config.CSRFResponseHeader == "" {
+		return nil
+	}
+	if token := resp.Header.Get(s.config.CSRFResponseHeader); token != "" {
+		s.mu.Lock()
+		s.csrfToken = token
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// token returns the CSRF token captured from the responses or, if not
+// available, from the cookie.
+func (s *Session) token(u *url.URL) string {
+	s.mu.Lock()
+	token := s.csrfToken
+	s.mu.Unlock()
+	if token != "" || s.config.CSRFCookie == "" {
+		return token
+	}
+	for _, cookie := range s.client.client.Jar.Cookies(u) {
+		if cookie.Name == s.config.CSRFCookie {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// runRequestHook runs the request hook of the request, if any.
+func runRequestHook(req *http.Request) {
+	if hook, ok := req.Context().Value(requestHookKey{}).(func(*http.Request)); ok {
+		hook(req)
+	}
+}
+
+// checkResponseHook runs the response hook of the request, if any.
+func checkResponseHook(req *http.Request, resp *http.Response) error {
+	if hook, ok := req.Context().Value(responseHookKey{}).(func(*http.Response) error); ok {
+		return hook(resp)
+	}
+	return nil
+}
+
+// cloneWithBody clones the request to send it again, replaying its body.
+func cloneWithBody(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
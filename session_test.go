@@ -0,0 +1,203 @@
+package jsonclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	session := ""
+	expiry := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.URL.Path {
+		case "/login":
+			if req.Method == http.MethodGet {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("<html>login</html>"))
+				return
+			}
+			if req.FormValue("password") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			session = "s" + strconv.Itoa(logins)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: session, Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: "csrf-" + session, Path: "/"})
+			return
+		case "/expire":
+			session = ""
+			return
+		case "/login-history":
+			w.Write([]byte(`{"session": "history"}`))
+			return
+		}
+
+		cookie, err := req.Cookie("session")
+		if err != nil || cookie.Value != session {
+			if expiry == http.StatusFound {
+				http.Redirect(w, req, "/login?next="+req.URL.Path, http.StatusFound)
+				return
+			}
+			w.WriteHeader(expiry)
+			return
+		}
+		if req.Method != http.MethodGet && req.Header.Get("X-XSRF-Token") != "csrf-"+session {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"session": "` + session + `"}`))
+	}))
+	defer server.Close()
+
+	newSessionWithOptions := func(t *testing.T, password string, opts Options) (*Client, *Session) {
+		t.Helper()
+		jar, err := NewCookieJar("")
+		require.NoError(t, err)
+		opts.CookieJar = jar
+		client, err := New(opts)
+		require.NoError(t, err)
+		s, err := NewSession(client, SessionConfig{
+			Login: func(ctx context.Context, client *Client) (*http.Request, error) {
+				req, err := client.NewRequestWithContext(ctx, http.MethodPost, "login?password="+password, nil)
+				return req, err
+			},
+			CSRFCookie: "XSRF-TOKEN",
+			CSRFHeader: "X-XSRF-Token",
+			LoginPath:  "/login",
+		})
+		require.NoError(t, err)
+		return client, s
+	}
+	newSession := func(t *testing.T, password string) (*Client, *Session) {
+		t.Helper()
+		return newSessionWithOptions(t, password, Options{BaseURL: server.URL})
+	}
+	do := func(t *testing.T, client *Client, s *Session, method string) (string, error) {
+		t.Helper()
+		req, err := client.NewRequest(method, "data", map[string]int{"a": 1})
+		require.NoError(t, err)
+		var v map[string]string
+		_, err = s.Do(req, &v)
+		return v["session"], err
+	}
+	expire := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		session = "expired"
+	}
+	reset := func(status int) {
+		mu.Lock()
+		defer mu.Unlock()
+		logins = 0
+		expiry = status
+	}
+
+	t.Run("logs in and echoes the csrf token", func(t *testing.T) {
+		reset(http.StatusUnauthorized)
+		client, s := newSession(t, "secret")
+		value, err := do(t, client, s, http.MethodPost)
+		require.NoError(t, err)
+		require.Equal(t, "s1", value)
+		value, err = do(t, client, s, http.MethodPost)
+		require.NoError(t, err)
+		require.Equal(t, "s1", value)
+		require.Equal(t, 1, logins)
+	})
+
+	for name, status := range map[string]int{
+		"unauthorized":      http.StatusUnauthorized,
+		"forbidden":         http.StatusForbidden,
+		"redirect to login": http.StatusFound,
+	} {
+		t.Run("re-authenticates once on "+name, func(t *testing.T) {
+			reset(status)
+			client, s := newSession(t, "secret")
+			require.NoError(t, s.Login(context.Background()))
+
+			expire()
+			value, err := do(t, client, s, http.MethodPut)
+			require.NoError(t, err)
+			require.Equal(t, "s2", value)
+			require.Equal(t, 2, logins)
+		})
+	}
+
+	t.Run("echoes the csrf cookie of the endpoint", func(t *testing.T) {
+		reset(http.StatusUnauthorized)
+		client, s := newSessionWithOptions(t, "secret", Options{Endpoints: &EndpointPool{BaseURLs: []string{server.URL}}})
+		value, err := do(t, client, s, http.MethodPost)
+		require.NoError(t, err)
+		require.Equal(t, "s1", value)
+	})
+
+	t.Run("expires only when redirected to the login path", func(t *testing.T) {
+		reset(http.StatusFound)
+		client, s := newSession(t, "secret")
+		require.NoError(t, s.Login(context.Background()))
+
+		_, err := s.Do(mustRequest(t, client, "login"), nil)
+		require.NoError(t, err)
+
+		var v map[string]string
+		_, err = s.Do(mustRequest(t, client, "login-history"), &v)
+		require.NoError(t, err)
+		require.Equal(t, "history", v["session"])
+		require.Equal(t, 1, logins)
+	})
+
+	t.Run("returns the error if still expired", func(t *testing.T) {
+		reset(http.StatusUnauthorized)
+		client, s := newSession(t, "secret")
+		require.NoError(t, s.Login(context.Background()))
+
+		_, err := s.Do(mustRequest(t, client, "/expire"), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, logins)
+
+		s.config.Login = func(ctx context.Context, client *Client) (*http.Request, error) {
+			return client.NewRequestWithContext(ctx, http.MethodPost, "expire", nil)
+		}
+		_, err = do(t, client, s, http.MethodGet)
+		require.ErrorIs(t, err, ErrSessionExpired)
+	})
+
+	t.Run("login failure", func(t *testing.T) {
+		reset(http.StatusUnauthorized)
+		client, s := newSession(t, "wrong")
+		_, err := do(t, client, s, http.MethodGet)
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		require.EqualError(t, err, "session login: POST "+server.URL+"/login?password=wrong: 401")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		client, err := New(Options{})
+		require.NoError(t, err)
+		_, err = NewSession(client, SessionConfig{})
+		require.EqualError(t, err, "session requires a client with a cookie jar")
+
+		client, err = New(Options{CookieJar: &CookieJar{}})
+		require.NoError(t, err)
+		_, err = NewSession(client, SessionConfig{})
+		require.EqualError(t, err, "session without login")
+	})
+}
+
+func mustRequest(t *testing.T, client *Client, urlStr string) *http.Request {
+	t.Helper()
+	req, err := client.NewRequest(http.MethodGet, urlStr, nil)
+	require.NoError(t, err)
+	return req
+}
@@ -0,0 +1,461 @@
+package jsonclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultShadowConcurrency = 10
+	defaultShadowTimeout     = 10 * time.Second
+	// maxShadowBodySize is the maximum size of the bodies compared.
+	maxShadowBodySize = 1 << 20
+)
+
+// Differences between the primary and the shadow responses
+const (
+	// DiffChanged is a value different in the shadow response.
+	DiffChanged = "changed"
+	// DiffMissing is a value of the primary response missing in the shadow one.
+	DiffMissing = "missing"
+	// DiffAdded is a value of the shadow response missing in the primary one.
+	DiffAdded = "added"
+)
+
+// ShadowTraffic struct define the mirroring of a percentage of the requests
+// sent with Do to a secondary base url. Mirrored requests are sent
+// asynchronously and never affect the primary ones: their responses are
+// compared with the primary responses, and the differences reported to
+// OnMismatch. Only the requests with safe methods are mirrored, unless
+// MirrorUnsafeMethods is set.
+type ShadowTraffic struct {
+	// BaseURL is the secondary base url, the relative url of the requests is
+	// resolved against it.
+	BaseURL string
+	// Percentage of the requests mirrored, from 0 to 100.
+	Percentage float64
+	// IgnoreFields are JSON pointers of the volatile fields not compared,
+	// e.g. `/updatedAt` or `/items/*/id`, where `*` matches any key or index.
+	IgnoreFields []string
+	// OnMismatch is called with the report of the responses with a different
+	// status code or body, and of the shadow requests failed.
+	OnMismatch func(ShadowReport)
+	// MaxConcurrency is the maximum number of shadow requests in flight.
+	// Default to 10.
+	MaxConcurrency int
+	// RatePerSecond is the maximum number of shadow requests sent per second.
+	// Zero means no limit.
+	RatePerSecond float64
+	// Timeout of the shadow requests. Default to 10 seconds.
+	Timeout time.Duration
+	// MirrorUnsafeMethods mirrors also the requests with unsafe methods
+	// (e.g. POST or DELETE), sent with the same headers, credentials and
+	// idempotency key, which could change the state of the secondary
+	// environment. By default, only GET, HEAD, OPTIONS and TRACE requests
+	// are mirrored.
+	MirrorUnsafeMethods bool
+}
+
+// ShadowReport struct define the comparison of a primary and a shadow
+// response. Err is set if the shadow request failed. Differences are not
+// computed if one of the bodies is too large or not fully read by Do.
+type ShadowReport struct {
+	Method        string
+	URL           string
+	ShadowURL     string
+	PrimaryStatus int
+	ShadowStatus  int
+	Differences   []JSONDifference
+	Err           error
+}
+
+// JSONDifference struct define a difference between two json documents. Path
+// is the JSON pointer of the value, Type one of DiffChanged, DiffMissing or
+// DiffAdded.
+type JSONDifference struct {
+	Path    string
+	Type    string
+	Primary interface{}
+	Shadow  interface{}
+}
+
+func (d JSONDifference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "/"
+	}
+	switch d.Type {
+	case DiffMissing:
+		return fmt.Sprintf("%s: missing in shadow", path)
+	case DiffAdded:
+		return fmt.Sprintf("%s: added in shadow", path)
+	}
+	return fmt.Sprintf("%s: %v != %v", path, d.Primary, d.Shadow)
+}
+
+type shadowMirror struct {
+	config  ShadowTraffic
+	baseURL *url.URL
+	client  *http.Client
+	ignored [][]string
+	slots   chan struct{}
+
+	mtx    sync.Mutex
+	random *rand.Rand
+	tokens float64
+	last   time.Time
+}
+
+func newShadowMirror(config ShadowTraffic, client *http.Client) (*shadowMirror, error) {
+	baseURL, err := parseBaseURL(config.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !isBaseURLSet(config.BaseURL) {
+		return nil, fmt.Errorf("shadow traffic without base url")
+	}
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = defaultShadowConcurrency
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultShadowTimeout
+	}
+
+	m := &shadowMirror{
+		config:  config,
+		baseURL: baseURL,
+		client:  client,
+		slots:   make(chan struct{}, config.MaxConcurrency),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		tokens:  rateBurst(config.RatePerSecond),
+		last:    time.Now(),
+	}
+	for _, field := range config.IgnoreFields {
+		m.ignored = append(m.ignored, splitPointer(field))
+	}
+	return m, nil
+}
+
+// isSafeMethod reports whether the method is safe (RFC 9110), i.e. read only.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func rateBurst(rate float64) float64 {
+	if rate < 1 {
+		return 1
+	}
+	return rate
+}
+
+// allow samples the request and applies the rate limit.
+func (m *shadowMirror) allow() bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.random.Float64()*100 >= m.config.Percentage {
+		return false
+	}
+	if m.config.RatePerSecond <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	m.tokens += now.Sub(m.last).Seconds() * m.config.RatePerSecond
+	if burst := rateBurst(m.config.RatePerSecond); m.tokens > burst {
+		m.tokens = burst
+	}
+	m.last = now
+	if m.tokens < 1 {
+		return false
+	}
+	m.tokens--
+	return true
+}
+
+// shadowRequest is a mirrored request, waiting for the primary response.
+type shadowRequest struct {
+	primary chan primaryResult
+	capture *captureReader
+}
+
+type primaryResult struct {
+	ok          bool
+	status      int
+	body        []byte
+	compareBody bool
+}
+
+// start mirrors the request, if sampled. The request must have a replayable
+// body and an url relative to clientBase.
+func (m *shadowMirror) start(req *http.Request, clientBase *url.URL) *shadowRequest {
+	if !m.config.MirrorUnsafeMethods && !isSafeMethod(req.Method) {
+		return nil
+	}
+	ref, ok := strings.CutPrefix(req.URL.String(), clientBase.String())
+	if !ok || !m.allow() {
+		return nil
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return nil
+	}
+
+	shadowReq, cancel, err := m.newRequest(req, ref)
+	if err != nil {
+		<-m.slots
+		return nil
+	}
+
+	s := &shadowRequest{primary: make(chan primaryResult, 1)}
+	go func() {
+		defer func() { <-m.slots }()
+		defer cancel()
+		m.run(req, shadowReq, s.primary)
+	}()
+	return s
+}
+
+func (m *shadowMirror) newRequest(req *http.Request, ref string) (*http.Request, context.CancelFunc, error) {
+	u, err := m.baseURL.Parse(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	var body io.ReadCloser
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, nil, fmt.Errorf("request body can not be replayed")
+		}
+		if body, err = req.GetBody(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	shadowReq := req.Clone(ctx)
+	shadowReq.URL = u
+	shadowReq.Body = body
+	if req.Host == req.URL.Host {
+		shadowReq.Host = u.Host
+	}
+	return shadowReq, cancel, nil
+}
+
+func (m *shadowMirror) run(req, shadowReq *http.Request, primary <-chan primaryResult) {
+	report := ShadowReport{
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		ShadowURL: shadowReq.URL.String(),
+	}
+
+	var shadowBody []byte
+	shadowComplete := true
+	resp, err := m.client.Do(shadowReq)
+	if err == nil {
+		report.ShadowStatus = resp.StatusCode
+		shadowBody, err = readLimited(resp.Body, maxShadowBodySize)
+		drainAndClose(resp.Body)
+		var tooLarge *BodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			shadowComplete, err = false, nil
+		}
+	}
+
+	result := <-primary
+	if !result.ok || m.config.OnMismatch == nil {
+		return
+	}
+	report.PrimaryStatus = result.status
+	if err != nil {
+		report.Err = err
+		m.config.OnMismatch(report)
+		return
+	}
+	if result.compareBody && shadowComplete {
+		report.Differences = m.diff(result.body, shadowBody)
+	}
+	if report.PrimaryStatus != report.ShadowStatus || len(report.Differences) > 0 {
+		m.config.OnMismatch(report)
+	}
+}
+
+// captureResponse keeps a copy of the primary response body, as read by Do.
+func (s *shadowRequest) captureResponse(resp *http.Response) {
+	s.capture = &captureReader{r: resp.Body}
+	resp.Body = limitedReadCloser{
+		Reader: s.capture,
+		Closer: resp.Body,
+	}
+}
+
+// finish sends the primary response to the shadow request. A nil response
+// means the primary request failed.
+func (s *shadowRequest) finish(resp *http.Response) {
+	if resp == nil {
+		s.primary <- primaryResult{}
+		return
+	}
+	s.primary <- primaryResult{
+		ok:          true,
+		status:      resp.StatusCode,
+		body:        s.capture.buf.Bytes(),
+		compareBody: s.capture.eof && !s.capture.truncated,
+	}
+}
+
+// captureReader keeps a copy of up to maxShadowBodySize bytes read.
+type captureReader struct {
+	r         io.Reader
+	buf       bytes.Buffer
+	truncated bool
+	eof       bool
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.buf.Len()+n > maxShadowBodySize {
+		c.truncated = true
+	} else {
+		c.buf.Write(p[:n])
+	}
+	if err == io.EOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+// diff compares the json bodies, or the raw bodies if they are not json.
+func (m *shadowMirror) diff(primary, shadow []byte) []JSONDifference {
+	primaryValue, primaryErr := decodeGeneric(primary)
+	shadowValue, shadowErr := decodeGeneric(shadow)
+	if primaryErr != nil || shadowErr != nil {
+		if bytes.Equal(primary, shadow) {
+			return nil
+		}
+		return []JSONDifference{{Type: DiffChanged, Primary: string(primary), Shadow: string(shadow)}}
+	}
+	return m.diffValues(nil, primaryValue, shadowValue, nil)
+}
+
+func decodeGeneric(data []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func (m *shadowMirror) diffValues(path []string, primary, shadow interface{}, diffs []JSONDifference) []JSONDifference {
+	if m.isIgnored(path) {
+		return diffs
+	}
+	pointer := joinPointer(path)
+
+	switch p := primary.(type) {
+	case map[string]interface{}:
+		s, ok := shadow.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(p) {
+			childPath := append(path[:len(path):len(path)], key)
+			if sv, ok := s[key]; ok {
+				diffs = m.diffValues(childPath, p[key], sv, diffs)
+			} else if !m.isIgnored(childPath) {
+				diffs = append(diffs, JSONDifference{Path: joinPointer(childPath), Type: DiffMissing, Primary: p[key]})
+			}
+		}
+		for _, key := range sortedKeys(s) {
+			childPath := append(path[:len(path):len(path)], key)
+			if _, ok := p[key]; !ok && !m.isIgnored(childPath) {
+				diffs = append(diffs, JSONDifference{Path: joinPointer(childPath), Type: DiffAdded, Shadow: s[key]})
+			}
+		}
+		return diffs
+	case []interface{}:
+		s, ok := shadow.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(p) || i < len(s); i++ {
+			childPath := append(path[:len(path):len(path)], strconv.Itoa(i))
+			switch {
+			case i >= len(s):
+				if !m.isIgnored(childPath) {
+					diffs = append(diffs, JSONDifference{Path: joinPointer(childPath), Type: DiffMissing, Primary: p[i]})
+				}
+			case i >= len(p):
+				if !m.isIgnored(childPath) {
+					diffs = append(diffs, JSONDifference{Path: joinPointer(childPath), Type: DiffAdded, Shadow: s[i]})
+				}
+			default:
+				diffs = m.diffValues(childPath, p[i], s[i], diffs)
+			}
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(primary, shadow) {
+		diffs = append(diffs, JSONDifference{Path: pointer, Type: DiffChanged, Primary: primary, Shadow: shadow})
+	}
+	return diffs
+}
+
+func (m *shadowMirror) isIgnored(path []string) bool {
+	for _, ignored := range m.ignored {
+		if len(ignored) != len(path) {
+			continue
+		}
+		match := true
+		for i, segment := range ignored {
+			if segment != "*" && segment != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPointer splits a JSON pointer in its unescaped segments. As in RFC
+// 6901, "" is the whole document and "/" the empty-string key.
+func splitPointer(pointer string) []string {
+	if pointer == "" {
+		return []string{}
+	}
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+	}
+	return segments
+}
+
+func joinPointer(path []string) string {
+	var b strings.Builder
+	for _, segment := range path {
+		b.WriteString("/" + escapeJSONPointer(segment))
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowTraffic(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		w.Write([]byte(`{"name": "a", "updatedAt": "1", "items": [{"id": 1, "v": 1}], "body": "` + strings.TrimSpace(string(body)) + `"}`))
+	}))
+	defer primary.Close()
+
+	var shadowCalls int64
+	var shadowServer *httptest.Server
+	newClient := func(t *testing.T, handler http.HandlerFunc, shadow ShadowTraffic) (*Client, chan ShadowReport) {
+		t.Helper()
+		atomic.StoreInt64(&shadowCalls, 0)
+		shadowServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&shadowCalls, 1)
+			handler(w, req)
+		}))
+		t.Cleanup(shadowServer.Close)
+
+		reports := make(chan ShadowReport, 10)
+		if shadow.BaseURL == "" {
+			shadow.BaseURL = shadowServer.URL + "/v2"
+		}
+		shadow.OnMismatch = func(report ShadowReport) {
+			reports <- report
+		}
+		client, err := New(Options{BaseURL: primary.URL + "/v1", Shadow: &shadow})
+		require.NoError(t, err)
+		return client, reports
+	}
+	do := func(t *testing.T, client *Client, method string, body interface{}) {
+		t.Helper()
+		req, err := client.NewRequestWithContext(context.Background(), method, "resource?q=1", body)
+		require.NoError(t, err)
+		var v map[string]interface{}
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, "a", v["name"])
+	}
+	waitShadowCalls := func(t *testing.T, expected int64) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&shadowCalls) == expected
+		}, time.Second, 5*time.Millisecond)
+	}
+	// waitShadowIdle waits for the mirrored requests to be compared
+	waitShadowIdle := func(t *testing.T, client *Client) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			return len(client.shadow.slots) == 0
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("reports differences ignoring volatile fields", func(t *testing.T) {
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			require.Equal(t, "/v2/resource", req.URL.Path)
+			require.Equal(t, "q=1", req.URL.RawQuery)
+			body, _ := io.ReadAll(req.Body)
+			w.Write([]byte(`{"name": "b", "updatedAt": "2", "items": [{"id": 2, "v": 1}, {"id": 3}], "extra": true, "body": "` + strings.TrimSpace(string(body)) + `"}`))
+		}
+		client, reports := newClient(t, handler, ShadowTraffic{Percentage: 100, IgnoreFields: []string{"/updatedAt", "/items/*/id"}, MirrorUnsafeMethods: true})
+
+		do(t, client, http.MethodPost, 42)
+
+		report := <-reports
+		require.Equal(t, http.MethodPost, report.Method)
+		require.Equal(t, primary.URL+"/v1/resource?q=1", report.URL)
+		require.Equal(t, shadowServer.URL+"/v2/resource?q=1", report.ShadowURL)
+		require.Equal(t, http.StatusOK, report.PrimaryStatus)
+		require.Equal(t, http.StatusOK, report.ShadowStatus)
+		require.NoError(t, report.Err)
+		require.Equal(t, []JSONDifference{
+			{Path: "/items/1", Type: DiffAdded, Shadow: map[string]interface{}{"id": json.Number("3")}},
+			{Path: "/name", Type: DiffChanged, Primary: "a", Shadow: "b"},
+			{Path: "/extra", Type: DiffAdded, Shadow: true},
+		}, report.Differences)
+	})
+
+	t.Run("does not report equal responses", func(t *testing.T) {
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(`{"updatedAt": "2", "name": "a", "items": [{"v": 1, "id": 1}], "body": ""}`))
+		}
+		client, reports := newClient(t, handler, ShadowTraffic{Percentage: 100, IgnoreFields: []string{"/updatedAt"}})
+
+		do(t, client, http.MethodGet, nil)
+		waitShadowCalls(t, 1)
+		waitShadowIdle(t, client)
+		require.Empty(t, reports)
+	})
+
+	t.Run("mirrors only safe methods by default", func(t *testing.T) {
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			require.Equal(t, http.MethodGet, req.Method)
+		}
+		client, _ := newClient(t, handler, ShadowTraffic{Percentage: 100})
+
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodGet} {
+			do(t, client, method, nil)
+		}
+		waitShadowCalls(t, 1)
+		waitShadowIdle(t, client)
+		require.EqualValues(t, 1, atomic.LoadInt64(&shadowCalls))
+	})
+
+	t.Run("reports status mismatches and failures", func(t *testing.T) {
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		client, reports := newClient(t, handler, ShadowTraffic{Percentage: 100})
+
+		do(t, client, http.MethodGet, nil)
+		report := <-reports
+		require.Equal(t, http.StatusOK, report.PrimaryStatus)
+		require.Equal(t, http.StatusInternalServerError, report.ShadowStatus)
+
+		client, reports = newClient(t, handler, ShadowTraffic{Percentage: 100, BaseURL: "http://127.0.0.1:1/"})
+		do(t, client, http.MethodGet, nil)
+		report = <-reports
+		require.Error(t, report.Err)
+	})
+
+	t.Run("never delays the primary", func(t *testing.T) {
+		release := make(chan struct{})
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			<-release
+		}
+		client, _ := newClient(t, handler, ShadowTraffic{Percentage: 100, MaxConcurrency: 1})
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			do(t, client, http.MethodGet, nil)
+		}
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+		waitShadowCalls(t, 1)
+		close(release)
+	})
+
+	t.Run("respects percentage and rate", func(t *testing.T) {
+		handler := func(w http.ResponseWriter, req *http.Request) {}
+
+		client, _ := newClient(t, handler, ShadowTraffic{Percentage: 0})
+		for i := 0; i < 5; i++ {
+			do(t, client, http.MethodGet, nil)
+		}
+		require.Zero(t, atomic.LoadInt64(&shadowCalls))
+
+		client, _ = newClient(t, handler, ShadowTraffic{Percentage: 100, RatePerSecond: 1})
+		for i := 0; i < 5; i++ {
+			do(t, client, http.MethodGet, nil)
+		}
+		waitShadowCalls(t, 1)
+	})
+
+	t.Run("requires a base url", func(t *testing.T) {
+		_, err := New(Options{Shadow: &ShadowTraffic{Percentage: 100}})
+		require.EqualError(t, err, "shadow traffic without base url")
+	})
+}
+
+func TestJSONDifferenceString(t *testing.T) {
+	require.Equal(t, "/a: 1 != 2", JSONDifference{Path: "/a", Type: DiffChanged, Primary: 1, Shadow: 2}.String())
+	require.Equal(t, "/: missing in shadow", JSONDifference{Type: DiffMissing}.String())
+	require.Equal(t, "/b: added in shadow", JSONDifference{Path: "/b", Type: DiffAdded}.String())
+}
+
+func TestSplitPointer(t *testing.T) {
+	require.Equal(t, []string{}, splitPointer(""))
+	require.Equal(t, []string{""}, splitPointer("/"))
+	require.Equal(t, []string{"a", ""}, splitPointer("/a/"))
+	require.Equal(t, []string{"a/b", "m~n", "*"}, splitPointer("/a~1b/m~0n/*"))
+	require.Equal(t, "/", joinPointer(splitPointer("/")))
+}
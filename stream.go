@@ -0,0 +1,282 @@
+package jsonclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Streaming formats
+const (
+	// StreamJSONArray encodes the items as a json array.
+	StreamJSONArray StreamFormat = iota
+	// StreamNDJSON encodes the items as newline delimited json.
+	StreamNDJSON
+)
+
+// NDJSONContentType is the content type of newline delimited json bodies
+const NDJSONContentType = "application/x-ndjson"
+
+// StreamFormat define how the items of a streamed body are encoded.
+type StreamFormat int
+
+// StreamEncodeError struct define a failure encoding a streamed request body.
+// Index is the index of the item which failed, or -1 for a single value.
+type StreamEncodeError struct {
+	Index int
+	Err   error
+}
+
+func (e *StreamEncodeError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("streaming request body: %s", e.Err)
+	}
+	return fmt.Sprintf("streaming request body: item %d: %s", e.Index, e.Err)
+}
+
+func (e *StreamEncodeError) Unwrap() error {
+	return e.Err
+}
+
+// StreamBody is a request body encoded while the request is in flight,
+// through a pipe, instead of being buffered. Pass it as body to
+// NewRequestWithContext. Streamed bodies are not validated by the
+// SchemaValidator.
+type StreamBody struct {
+	contentType string
+	replayable  bool
+	encode      func(ctx context.Context, w io.Writer, done <-chan struct{}) error
+}
+
+// ContentType returns the content type of the streamed body.
+func (b *StreamBody) ContentType() string {
+	return b.contentType
+}
+
+// StreamValue streams the json encoding of v. The body could be replayed
+// (e.g. on redirects), encoding v again.
+func StreamValue(v interface{}) *StreamBody {
+	return &StreamBody{
+		contentType: "application/json",
+		replayable:  true,
+		encode: func(ctx context.Context, w io.Writer, done <-chan struct{}) error {
+			if err := newStreamEncoder(w).Encode(v); err != nil {
+				return &StreamEncodeError{Index: -1, Err: err}
+			}
+			return nil
+		},
+	}
+}
+
+// StreamSeq streams the items yielded by seq in the passed format. The body
+// could be replayed calling seq again, so seq must yield the same items each
+// time it is called.
+func StreamSeq[T any](format StreamFormat, seq func(yield func(T) bool)) *StreamBody {
+	return &StreamBody{
+		contentType: format.contentType(),
+		replayable:  true,
+		encode: func(ctx context.Context, w io.Writer, done <-chan struct{}) error {
+			items := newItemWriter(format, w)
+			var err error
+			seq(func(item T) bool {
+				select {
+				case <-done:
+					err = io.ErrClosedPipe
+					return false
+				default:
+				}
+				err = items.write(item)
+				return err == nil
+			})
+			if err != nil {
+				return err
+			}
+			return items.close()
+		},
+	}
+}
+
+// StreamChannel streams the items received from ch, until it is closed, in
+// the passed format. The body could not be replayed.
+func StreamChannel[T any](format StreamFormat, ch <-chan T) *StreamBody {
+	return &StreamBody{
+		contentType: format.contentType(),
+		encode: func(ctx context.Context, w io.Writer, done <-chan struct{}) error {
+			items := newItemWriter(format, w)
+			for {
+				select {
+				case item, ok := <-ch:
+					if !ok {
+						return items.close()
+					}
+					if err := items.write(item); err != nil {
+						return err
+					}
+				case <-done:
+					return io.ErrClosedPipe
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		},
+	}
+}
+
+func (f StreamFormat) contentType() string {
+	if f == StreamNDJSON {
+		return NDJSONContentType
+	}
+	return "application/json"
+}
+
+// streamState is shared by all the readers of a request body, to report the
+// encoding error to Do.
+type streamState struct {
+	mtx sync.Mutex
+	err error
+}
+
+func (s *streamState) setErr(err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *streamState) Err() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// streamReader is the read side of the pipe where the body is encoded. The
+// encoding starts on the first read, so that a body never sent does not
+// leave the encoding goroutine blocked on the pipe.
+type streamReader struct {
+	*io.PipeReader
+	state     *streamState
+	start     func()
+	startOnce sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	r.startOnce.Do(r.start)
+	return r.PipeReader.Read(p)
+}
+
+func (r *streamReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	// a body closed before being read is never encoded
+	r.startOnce.Do(func() {})
+	return r.PipeReader.Close()
+}
+
+// open returns a reader of the body, encoded in a new goroutine when it is
+// first read.
+func (b *StreamBody) open(ctx context.Context, state *streamState) io.ReadCloser {
+	pr, pw := io.Pipe()
+	reader := &streamReader{PipeReader: pr, state: state, done: make(chan struct{})}
+	reader.start = func() {
+		go func() {
+			buffered := bufio.NewWriter(pw)
+			err := b.encode(ctx, buffered, reader.done)
+			if err == nil {
+				err = buffered.Flush()
+			}
+			if _, ok := err.(*StreamEncodeError); ok {
+				state.setErr(err)
+			}
+			pw.CloseWithError(err)
+		}()
+	}
+	return reader
+}
+
+// setStreamBody sets the streamed body of the request.
+func setStreamBody(req *http.Request, body *StreamBody) {
+	ctx := req.Context()
+	state := &streamState{}
+	req.Body = body.open(ctx, state)
+	req.ContentLength = -1
+	if body.replayable {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return body.open(ctx, state), nil
+		}
+	}
+}
+
+// closeBody closes the body of a request which is not sent, e.g. to release
+// its streamed body.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// streamError returns the encoding error of the streamed request body, if any.
+func streamError(req *http.Request) error {
+	if reader, ok := req.Body.(*streamReader); ok {
+		return reader.state.Err()
+	}
+	return nil
+}
+
+type itemWriter struct {
+	format StreamFormat
+	w      io.Writer
+	index  int
+}
+
+func newItemWriter(format StreamFormat, w io.Writer) *itemWriter {
+	return &itemWriter{format: format, w: w}
+}
+
+func (iw *itemWriter) write(item interface{}) error {
+	if iw.format == StreamJSONArray {
+		sep := ","
+		if iw.index == 0 {
+			sep = "["
+		}
+		if _, err := io.WriteString(iw.w, sep); err != nil {
+			return err
+		}
+	}
+	// encoding in memory first, to not write partial items to the pipe
+	var buf bytes.Buffer
+	if err := newStreamEncoder(&buf).Encode(item); err != nil {
+		return &StreamEncodeError{Index: iw.index, Err: err}
+	}
+	if _, err := iw.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	iw.index++
+	return nil
+}
+
+func (iw *itemWriter) close() error {
+	if iw.format != StreamJSONArray {
+		return nil
+	}
+	end := "]\n"
+	if iw.index == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(iw.w, end)
+	return err
+}
+
+func newStreamEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc
+}
@@ -0,0 +1,157 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamBody(t *testing.T) {
+	type received struct {
+		contentType      string
+		transferEncoding []string
+		body             string
+	}
+	var requests []received
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, received{
+			contentType:      req.Header.Get("Content-Type"),
+			transferEncoding: req.TransferEncoding,
+			body:             string(body),
+		})
+		if req.URL.Path == "/redirect" {
+			http.Redirect(w, req, "/items", http.StatusTemporaryRedirect)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+
+	client, err := New(Options{BaseURL: s.URL})
+	require.NoError(t, err)
+
+	do := func(t *testing.T, path string, body *StreamBody) error {
+		t.Helper()
+		requests = nil
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodPost, path, body)
+		require.NoError(t, err)
+		_, err = client.Do(req, nil)
+		return err
+	}
+
+	type item struct {
+		Name string `json:"name"`
+	}
+	seq := func(yield func(item) bool) {
+		for _, name := range []string{"a", "<b>"} {
+			if !yield(item{Name: name}) {
+				return
+			}
+		}
+	}
+
+	t.Run("value", func(t *testing.T) {
+		require.NoError(t, do(t, "items", StreamValue(map[string]string{"name": "<a>"})))
+		require.Equal(t, []received{{
+			contentType:      "application/json",
+			transferEncoding: []string{"chunked"},
+			body:             `{"name":"<a>"}` + "\n",
+		}}, requests)
+	})
+
+	t.Run("seq as json array", func(t *testing.T) {
+		require.NoError(t, do(t, "items", StreamSeq(StreamJSONArray, seq)))
+		require.Len(t, requests, 1)
+		require.Equal(t, "application/json", requests[0].contentType)
+		require.Equal(t, `[{"name":"a"}`+"\n"+`,{"name":"<b>"}`+"\n]\n", requests[0].body)
+
+		var items []item
+		require.NoError(t, json.Unmarshal([]byte(requests[0].body), &items))
+		require.Equal(t, []item{{Name: "a"}, {Name: "<b>"}}, items)
+	})
+
+	t.Run("empty seq as json array", func(t *testing.T) {
+		require.NoError(t, do(t, "items", StreamSeq(StreamJSONArray, func(yield func(item) bool) {})))
+		require.Equal(t, "[]\n", requests[0].body)
+	})
+
+	t.Run("channel as ndjson", func(t *testing.T) {
+		ch := make(chan item)
+		go func() {
+			defer close(ch)
+			ch <- item{Name: "a"}
+			ch <- item{Name: "b"}
+		}()
+
+		require.NoError(t, do(t, "items", StreamChannel(StreamNDJSON, ch)))
+		require.Equal(t, []received{{
+			contentType:      NDJSONContentType,
+			transferEncoding: []string{"chunked"},
+			body:             `{"name":"a"}` + "\n" + `{"name":"b"}` + "\n",
+		}}, requests)
+	})
+
+	t.Run("encodes the body only when it is sent", func(t *testing.T) {
+		calls := 0
+		body := StreamSeq(StreamNDJSON, func(yield func(item) bool) {
+			calls++
+			seq(yield)
+		})
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodPost, "items", body)
+		require.NoError(t, err)
+		require.NoError(t, req.Body.Close())
+		_, err = req.Body.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.ErrClosedPipe)
+		require.Zero(t, calls)
+
+		require.NoError(t, do(t, "items", body))
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("replays the body on redirects", func(t *testing.T) {
+		require.NoError(t, do(t, "redirect", StreamSeq(StreamNDJSON, seq)))
+		require.Len(t, requests, 2)
+		require.Equal(t, requests[0].body, requests[1].body)
+	})
+
+	t.Run("channel body is not replayable", func(t *testing.T) {
+		req, err := client.NewRequestWithContext(context.Background(), http.MethodPost, "items", StreamChannel(StreamNDJSON, make(chan item)))
+		require.NoError(t, err)
+		require.Nil(t, req.GetBody)
+		req.Body.Close()
+	})
+
+	t.Run("returns encoding errors", func(t *testing.T) {
+		values := func(yield func(float64) bool) {
+			for _, v := range []float64{1, 2, math.Inf(1)} {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+
+		err := do(t, "items", StreamSeq(StreamNDJSON, values))
+		var streamErr *StreamEncodeError
+		require.True(t, errors.As(err, &streamErr))
+		require.Equal(t, 2, streamErr.Index)
+		var unsupported *json.UnsupportedValueError
+		require.True(t, errors.As(err, &unsupported))
+		require.EqualError(t, err, "streaming request body: item 2: json: unsupported value: +Inf")
+
+		err = do(t, "items", StreamValue(math.NaN()))
+		require.True(t, errors.As(err, &streamErr))
+		require.Equal(t, -1, streamErr.Index)
+	})
+}
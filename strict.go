@@ -0,0 +1,229 @@
+package jsonclient
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Strict decoding errors
+var (
+	ErrUnknownField = errors.New("unknown field")
+	ErrTrailingData = errors.New("trailing data after json value")
+	ErrEmptyBody    = errors.New("empty response body")
+)
+
+// StrictDecodingError struct define a response body rejected by the strict
+// decoding. Err is one of ErrUnknownField, ErrTrailingData or ErrEmptyBody.
+// Path is the JSON pointer of the unknown field, Offset the byte offset of the
+// trailing data.
+type StrictDecodingError struct {
+	Path   string
+	Offset int64
+	Err    error
+}
+
+func (e *StrictDecodingError) Error() string {
+	switch e.Err {
+	case ErrUnknownField:
+		return fmt.Sprintf("strict decoding: %s %s", e.Err, e.Path)
+	case ErrTrailingData:
+		return fmt.Sprintf("strict decoding: %s at offset %d", e.Err, e.Offset)
+	}
+	return fmt.Sprintf("strict decoding: %s", e.Err)
+}
+
+func (e *StrictDecodingError) Unwrap() error {
+	return e.Err
+}
+
+// WithStrictDecoding enables (or disables) the strict decoding of the
+// response of the request, overriding the StrictDecoding client option.
+func WithStrictDecoding(strict bool) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.strictDecoding = &strict
+	}
+}
+
+func (c *Client) isStrictDecoding(req *http.Request) bool {
+	if cfg := requestConfigFrom(req); cfg != nil && cfg.strictDecoding != nil {
+		return *cfg.strictDecoding
+	}
+	return c.strictDecoding
+}
+
+// decodeStrict decodes the body into v rejecting unknown fields, trailing
+// data and empty bodies of the responses expected to carry content.
+func decodeStrict(resp *http.Response, data []byte, v interface{}) error {
+	if len(data) == 0 && !expectsContent(resp) {
+		return nil
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &StrictDecodingError{Err: ErrEmptyBody}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if isUnknownFieldError(err) {
+			return &StrictDecodingError{Path: unknownFieldPath(data, v), Err: ErrUnknownField}
+		}
+		return err
+	}
+
+	offset := dec.InputOffset()
+	if len(bytes.TrimSpace(data[offset:])) != 0 {
+		for offset < int64(len(data)) && isJSONSpace(data[offset]) {
+			offset++
+		}
+		return &StrictDecodingError{Offset: offset, Err: ErrTrailingData}
+	}
+	return nil
+}
+
+// isUnknownFieldError reports whether err is the error returned by a json
+// Decoder with DisallowUnknownFields for an unknown field. encoding/json has
+// no typed error for it, so its message is matched.
+func isUnknownFieldError(err error) bool {
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
+
+// expectsContent reports whether the response should carry a body: it is
+// not the response of a HEAD request, its status code is not 1xx, 201, 202,
+// 204, 205 or 304, and it does not declare a Content-Length of 0.
+func expectsContent(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusAccepted, http.StatusNoContent, http.StatusResetContent, http.StatusNotModified:
+		return false
+	}
+	return resp.StatusCode >= 200 && resp.ContentLength != 0
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// unknownFieldPath returns the JSON pointer of the first field of data not
+// known by the type of v.
+func unknownFieldPath(data []byte, v interface{}) string {
+	value, err := toJSONValue(json.RawMessage(data))
+	if err != nil {
+		return ""
+	}
+	path, _ := findUnknownField(value, reflect.TypeOf(v), "")
+	return path
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func findUnknownField(value interface{}, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Pointer {
+		if t.Implements(jsonUnmarshalerType) {
+			return "", false
+		}
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return "", false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		fields := map[string]reflect.Type{}
+		collectJSONFields(t, fields)
+		for _, key := range sortedKeys(obj) {
+			keyPath := path + "/" + escapeJSONPointer(key)
+			fieldType, ok := lookupJSONField(fields, key)
+			if !ok {
+				return keyPath, true
+			}
+			if p, found := findUnknownField(obj[key], fieldType, keyPath); found {
+				return p, true
+			}
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		for _, key := range sortedKeys(obj) {
+			if p, found := findUnknownField(obj[key], t.Elem(), path+"/"+escapeJSONPointer(key)); found {
+				return p, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return "", false
+		}
+		for i, item := range list {
+			if p, found := findUnknownField(item, t.Elem(), path+"/"+strconv.Itoa(i)); found {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// collectJSONFields collects the json field names of the struct, including
+// the fields promoted from embedded structs.
+func collectJSONFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectJSONFields(ft, fields)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, exists := fields[name]; !exists {
+			fields[name] = field.Type
+		}
+	}
+}
+
+// lookupJSONField matches the key as encoding/json does, preferring an exact
+// match over a case-insensitive one.
+func lookupJSONField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,158 @@
+package jsonclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	type Item struct {
+		ID string `json:"id"`
+	}
+	type Embedded struct {
+		Kind string `json:"kind"`
+	}
+	type Response struct {
+		Embedded
+		Name    string            `json:"name"`
+		Items   []Item            `json:"items"`
+		Labels  map[string]Item   `json:"labels"`
+		Created time.Time         `json:"created"`
+		Ignored string            `json:"-"`
+		Raw     map[string]string `json:"raw"`
+	}
+
+	var statusCode int
+	var body string
+	var chunked bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.Header().Set("Content-Length", "10")
+		}
+		w.WriteHeader(statusCode)
+		if chunked {
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer s.Close()
+
+	strictClient, err := New(Options{BaseURL: s.URL, StrictDecoding: true})
+	require.NoError(t, err)
+	lenientClient, err := New(Options{BaseURL: s.URL})
+	require.NoError(t, err)
+
+	do := func(t *testing.T, client *Client, ctx context.Context, status int, responseBody string, opts ...RequestOption) error {
+		t.Helper()
+		statusCode = status
+		body = responseBody
+		req, err := client.NewRequestWithContext(ctx, http.MethodGet, "resource", nil, opts...)
+		require.NoError(t, err)
+		_, err = client.Do(req, &Response{})
+		return err
+	}
+
+	t.Run("decodes known fields", func(t *testing.T) {
+		err := do(t, strictClient, context.Background(), 200, `{"kind": "a", "NAME": "b", "items": [{"id": "1"}], "labels": {"x": {"id": "2"}}, "created": "2020-01-01T00:00:00Z"}`+"\n")
+		require.NoError(t, err)
+	})
+
+	t.Run("rejects unknown fields with path", func(t *testing.T) {
+		tests := map[string]string{
+			`{"other": 1}`:                       "/other",
+			`{"items": [{"id": "1"}, {"x": 1}]}`: "/items/1/x",
+			`{"labels": {"a/b": {"y": 1}}}`:      "/labels/a~1b/y",
+			`{"name": "a", "Ignored": "no"}`:     "/Ignored",
+		}
+		for responseBody, path := range tests {
+			err := do(t, strictClient, context.Background(), 200, responseBody)
+			var strictErr *StrictDecodingError
+			require.True(t, errors.As(err, &strictErr), responseBody)
+			require.True(t, errors.Is(err, ErrUnknownField))
+			require.Equal(t, path, strictErr.Path)
+			require.EqualError(t, err, "strict decoding: unknown field "+path)
+		}
+	})
+
+	t.Run("rejects trailing data", func(t *testing.T) {
+		err := do(t, strictClient, context.Background(), 200, `{"name": "a"} garbage`)
+		var strictErr *StrictDecodingError
+		require.True(t, errors.As(err, &strictErr))
+		require.True(t, errors.Is(err, ErrTrailingData))
+		require.Equal(t, int64(14), strictErr.Offset)
+		require.EqualError(t, err, "strict decoding: trailing data after json value at offset 14")
+	})
+
+	t.Run("rejects empty body", func(t *testing.T) {
+		chunked = true
+		defer func() { chunked = false }()
+		err := do(t, strictClient, context.Background(), 200, "")
+		require.True(t, errors.Is(err, ErrEmptyBody))
+		require.EqualError(t, err, "strict decoding: empty response body")
+
+		err = do(t, strictClient, context.Background(), 200, " \n")
+		require.True(t, errors.Is(err, ErrEmptyBody))
+	})
+
+	t.Run("allows empty body without content", func(t *testing.T) {
+		require.NoError(t, do(t, strictClient, context.Background(), 204, ""))
+		require.NoError(t, do(t, strictClient, context.Background(), 205, ""))
+		require.NoError(t, do(t, strictClient, context.Background(), 201, ""))
+		require.NoError(t, do(t, strictClient, context.Background(), 202, ""))
+
+		// Content-Length: 0 is set by the server for the empty body
+		require.NoError(t, do(t, strictClient, context.Background(), 200, ""))
+
+		statusCode = 200
+		req, err := strictClient.NewRequest(http.MethodHead, "resource", nil)
+		require.NoError(t, err)
+		resp, err := strictClient.Do(req, &Response{})
+		require.NoError(t, err)
+		require.Equal(t, int64(10), resp.ContentLength)
+	})
+
+	t.Run("lenient by default", func(t *testing.T) {
+		require.NoError(t, do(t, lenientClient, context.Background(), 200, `{"other": 1} garbage`))
+		require.NoError(t, do(t, lenientClient, context.Background(), 200, ""))
+	})
+
+	t.Run("per request override", func(t *testing.T) {
+		err := do(t, lenientClient, context.Background(), 200, `{"other": 1}`, WithStrictDecoding(true))
+		require.True(t, errors.Is(err, ErrUnknownField))
+
+		err = do(t, strictClient, context.Background(), 200, `{"other": 1}`, WithStrictDecoding(false))
+		require.NoError(t, err)
+	})
+
+	t.Run("wraps syntax errors in DecodeError", func(t *testing.T) {
+		err := do(t, strictClient, context.Background(), 200, `{not json}`)
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.EqualError(t, decodeErr.Err, "invalid character 'n' looking for beginning of object key string")
+	})
+}
+
+func TestIsUnknownFieldError(t *testing.T) {
+	decode := func(data string) error {
+		dec := json.NewDecoder(strings.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(&struct {
+			ID int `json:"id"`
+		}{})
+	}
+
+	err := decode(`{"other": 1}`)
+	require.Error(t, err)
+	require.True(t, isUnknownFieldError(err), "encoding/json unknown field message changed: %s", err)
+
+	require.False(t, isUnknownFieldError(decode(`{"id": "a"}`)))
+	require.False(t, isUnknownFieldError(decode(`{"id"`)))
+}
@@ -0,0 +1,304 @@
+package jsonclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+// TLSConfig struct define the TLS configuration of the client. The files are
+// checked for changes at most once per ReloadInterval, when a connection is
+// opened, and reloaded if changed: the new connections use the new
+// certificates, while the open ones are not affected. Through a proxy, the
+// certificates of servers reached by ip address could not be verified with
+// CAFiles.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM encoded client certificate (with its
+	// chain) and key, sent to the servers requiring them (mTLS).
+	CertFile string
+	KeyFile  string
+	// CAFiles are PEM encoded bundles of the CAs trusted to verify the server
+	// certificates, instead of the system ones.
+	CAFiles []string
+	// MinVersion is the minimum TLS version. Default to TLS 1.2.
+	MinVersion uint16
+	// ServerName is used to verify the server certificate and sent as SNI,
+	// instead of the request host.
+	ServerName string
+	// ReloadInterval is the minimum interval between two checks of the files.
+	// Default to 10s. A negative value disables the reload.
+	ReloadInterval time.Duration
+	// OnReloadError, if set, is called when the changed files could not be
+	// reloaded, e.g. because they are not valid: the previous certificates
+	// are kept.
+	OnReloadError func(err error)
+}
+
+type tlsReloader struct {
+	config TLSConfig
+
+	mu       sync.Mutex
+	checked  time.Time
+	contents [][]byte
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+}
+
+func newTLSReloader(config TLSConfig) (*tlsReloader, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("tls cert and key files must be both set")
+	}
+	if config.ReloadInterval == 0 {
+		config.ReloadInterval = defaultTLSReloadInterval
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	r := &tlsReloader{config: config}
+	contents, err := r.readFiles()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(contents); err != nil {
+		return nil, err
+	}
+	r.checked = time.Now()
+	return r, nil
+}
+
+// snapshot returns the current certificates, reloading them if changed.
+func (r *tlsReloader) snapshot() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	err := r.reload()
+	cert, roots := r.cert, r.roots
+	r.mu.Unlock()
+
+	if err != nil && r.config.OnReloadError != nil {
+		r.config.OnReloadError(err)
+	}
+	return cert, roots
+}
+
+// tlsDialer dials the TLS connections of a transport with the current
+// certificates of the reloader, if any: the new connections use the reloaded
+// certificates, while the open ones are not affected. The connections to the
+// addresses in serverNames use the mapped server name.
+type tlsDialer struct {
+	reloader    *tlsReloader
+	serverNames map[string]string
+
+	dial             func(ctx context.Context, network, addr string) (net.Conn, error)
+	config           *tls.Config
+	transportConfig  *tls.Config
+	handshakeTimeout time.Duration
+}
+
+func newTLSDialer(reloader *tlsReloader, serverNames map[string]string) *tlsDialer {
+	return &tlsDialer{reloader: reloader, serverNames: serverNames}
+}
+
+// configure sets the dialer as the TLS dialer of the transport. The
+// connections through a proxy are not dialed by it, but by the transport
+// with its TLS configuration: it is set to send the current client
+// certificate and to verify the servers with the current CAs, while the
+// server names are not mapped.
+func (d *tlsDialer) configure(transport *http.Transport) {
+	d.dial = transport.DialContext
+	if d.dial == nil {
+		d.dial = (&net.Dialer{}).DialContext
+	}
+	d.handshakeTimeout = transport.TLSHandshakeTimeout
+
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+	if d.reloader != nil {
+		config.MinVersion = d.reloader.config.MinVersion
+		if d.reloader.config.ServerName != "" {
+			config.ServerName = d.reloader.config.ServerName
+		}
+	}
+	d.config = config
+
+	transportConfig := config.Clone()
+	d.transportConfig = transportConfig
+	transport.TLSClientConfig = transportConfig
+	transport.DialTLSContext = d.dialTLS
+	if d.reloader == nil {
+		return
+	}
+
+	if d.reloader.config.CertFile != "" {
+		transportConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := d.reloader.snapshot()
+			return cert, nil
+		}
+	}
+	if len(d.reloader.config.CAFiles) != 0 && !config.InsecureSkipVerify {
+		verify := config.VerifyConnection
+		transportConfig.InsecureSkipVerify = true
+		transportConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			chains, err := d.verify(cs)
+			if err != nil {
+				return err
+			}
+			cs.VerifiedChains = chains
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+}
+
+func (d *tlsDialer) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	config := d.config.Clone()
+	// the transport adds the http2 protocol to its configuration
+	config.NextProtos = d.transportConfig.NextProtos
+	if serverName, ok := d.serverNames[strings.ToLower(addr)]; ok {
+		config.ServerName = serverName
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	if d.reloader != nil {
+		cert, roots := d.reloader.snapshot()
+		if cert != nil {
+			config.Certificates = []tls.Certificate{*cert}
+		}
+		if roots != nil {
+			config.RootCAs = roots
+		}
+	}
+
+	conn, err := d.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.handshakeTimeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// verify verifies the server certificate of a connection through a proxy
+// with the current CAs. The server name is not available for ip addresses,
+// which are not sent as SNI, so their certificates could not be verified.
+func (d *tlsDialer) verify(cs tls.ConnectionState) ([][]*x509.Certificate, error) {
+	if cs.ServerName == "" {
+		return nil, fmt.Errorf("tls: cannot verify the certificate of an ip address through a proxy")
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("tls: server without certificates")
+	}
+	_, roots := d.reloader.snapshot()
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	return cs.PeerCertificates[0].Verify(opts)
+}
+
+// reload reloads the files if changed, keeping the current certificates if
+// they are not valid (e.g. while they are being written), and returning the
+// error. It must be called holding the lock.
+func (r *tlsReloader) reload() error {
+	if r.config.ReloadInterval < 0 || time.Since(r.checked) < r.config.ReloadInterval {
+		return nil
+	}
+	r.checked = time.Now()
+
+	contents, err := r.readFiles()
+	if err != nil {
+		return err
+	}
+	if r.isUnchanged(contents) {
+		return nil
+	}
+	return r.load(contents)
+}
+
+func (r *tlsReloader) files() []string {
+	var files []string
+	if r.config.CertFile != "" {
+		files = append(files, r.config.CertFile, r.config.KeyFile)
+	}
+	return append(files, r.config.CAFiles...)
+}
+
+func (r *tlsReloader) readFiles() ([][]byte, error) {
+	files := r.files()
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = data
+	}
+	return contents, nil
+}
+
+func (r *tlsReloader) isUnchanged(contents [][]byte) bool {
+	for i := range contents {
+		if !bytes.Equal(contents[i], r.contents[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *tlsReloader) load(contents [][]byte) error {
+	cas := contents
+	var cert *tls.Certificate
+	if r.config.CertFile != "" {
+		pair, err := tls.X509KeyPair(contents[0], contents[1])
+		if err != nil {
+			return fmt.Errorf("tls client certificate: %w", err)
+		}
+		cert = &pair
+		cas = contents[2:]
+	}
+
+	var roots *x509.CertPool
+	if len(cas) != 0 {
+		roots = x509.NewCertPool()
+		for i, data := range cas {
+			if !roots.AppendCertsFromPEM(data) {
+				return fmt.Errorf("tls: no certificates in %s", r.config.CAFiles[i])
+			}
+		}
+	}
+
+	r.contents = contents
+	r.cert = cert
+	r.roots = roots
+	return nil
+}
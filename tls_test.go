@@ -0,0 +1,212 @@
+package jsonclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeClientCert writes a self signed client certificate with the common
+// name, and its key, to the files.
+func writeClientCert(t *testing.T, commonName, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := ""
+		if len(req.TLS.PeerCertificates) != 0 {
+			name = req.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		w.Write([]byte(`{"client": "` + name + `"}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	writeClientCert(t, "first", certFile, keyFile)
+
+	type Response struct {
+		Client string `json:"client"`
+	}
+	get := func(t *testing.T, client *Client) (string, error) {
+		t.Helper()
+		req, err := client.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+		var v Response
+		_, err = client.Do(req, &v)
+		return v.Client, err
+	}
+
+	t.Run("mtls with custom ca and reload", func(t *testing.T) {
+		var mu sync.Mutex
+		var reloadErrs []error
+		errs := func() []error {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]error{}, reloadErrs...)
+		}
+		client, err := New(Options{
+			BaseURL:    server.URL,
+			HTTPClient: &http.Client{Transport: &http.Transport{DisableKeepAlives: true}},
+			TLS: &TLSConfig{
+				CertFile:       certFile,
+				KeyFile:        keyFile,
+				CAFiles:        []string{caFile},
+				ServerName:     "example.com",
+				ReloadInterval: time.Millisecond,
+				OnReloadError: func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					reloadErrs = append(reloadErrs, err)
+				},
+			},
+		})
+		require.NoError(t, err)
+		transport := client.client.Transport
+
+		name, err := get(t, client)
+		require.NoError(t, err)
+		require.Equal(t, "first", name)
+
+		// names sends requests until the condition on the client name seen by
+		// the server holds, returning the name
+		names := func(condition func(name string) bool) string {
+			var name string
+			require.Eventually(t, func() bool {
+				req, err := client.NewRequest(http.MethodGet, "", nil)
+				if err != nil {
+					return false
+				}
+				var v Response
+				if _, err = client.Do(req, &v); err != nil {
+					return false
+				}
+				name = v.Client
+				return condition(name)
+			}, time.Second, time.Millisecond)
+			return name
+		}
+
+		writeClientCert(t, "second", certFile, keyFile)
+		require.Equal(t, "second", names(func(name string) bool { return name == "second" }))
+
+		// invalid files are ignored, keeping the previous certificate
+		require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+		require.Equal(t, "second", names(func(string) bool { return len(errs()) != 0 }))
+		require.ErrorContains(t, errs()[0], "tls client certificate")
+		require.Same(t, transport, client.client.Transport)
+	})
+
+	t.Run("through a proxy", func(t *testing.T) {
+		var calls int64
+		proxy := newHTTPProxy(t, "user", "pass", &calls)
+		proxyConfig := &ProxyConfig{URL: "http://user:pass@" + proxy.Listener.Addr().String()}
+		writeClientCert(t, "proxied", certFile, keyFile)
+
+		client, err := New(Options{
+			BaseURL: server.URL,
+			Proxy:   proxyConfig,
+			TLS:     &TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFiles: []string{caFile}, ServerName: "example.com"},
+		})
+		require.NoError(t, err)
+		name, err := get(t, client)
+		require.NoError(t, err)
+		require.Equal(t, "proxied", name)
+		require.EqualValues(t, 1, atomic.LoadInt64(&calls))
+
+		client, err = New(Options{
+			BaseURL: server.URL,
+			Proxy:   proxyConfig,
+			TLS:     &TLSConfig{CAFiles: []string{caFile}, ServerName: "other.com"},
+		})
+		require.NoError(t, err)
+		_, err = get(t, client)
+		require.ErrorContains(t, err, "other.com")
+
+		client, err = New(Options{BaseURL: server.URL, Proxy: proxyConfig, TLS: &TLSConfig{CAFiles: []string{caFile}}})
+		require.NoError(t, err)
+		_, err = get(t, client)
+		require.ErrorContains(t, err, "cannot verify the certificate of an ip address through a proxy")
+	})
+
+	t.Run("verifies the server name", func(t *testing.T) {
+		client, err := New(Options{
+			BaseURL: server.URL,
+			TLS:     &TLSConfig{CAFiles: []string{caFile}, ServerName: "other.com"},
+		})
+		require.NoError(t, err)
+		_, err = get(t, client)
+		require.ErrorContains(t, err, "other.com")
+
+		client, err = New(Options{BaseURL: server.URL, TLS: &TLSConfig{CAFiles: []string{caFile}}})
+		require.NoError(t, err)
+		_, err = get(t, client)
+		require.NoError(t, err)
+
+		client, err = New(Options{BaseURL: strings.Replace(server.URL, "127.0.0.1", "localhost", 1), TLS: &TLSConfig{CAFiles: []string{caFile}}})
+		require.NoError(t, err)
+		_, err = get(t, client)
+		require.ErrorContains(t, err, "localhost")
+	})
+
+	t.Run("missing key and untrusted server", func(t *testing.T) {
+		client, err := New(Options{BaseURL: server.URL, TLS: &TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "key.pem")}})
+		require.Error(t, err)
+		require.Nil(t, client)
+
+		client, err = New(Options{BaseURL: server.URL, TLS: &TLSConfig{MinVersion: tls.VersionTLS13}})
+		require.NoError(t, err)
+		_, err = get(t, client)
+		require.ErrorContains(t, err, "certificate")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := New(Options{TLS: &TLSConfig{CertFile: certFile}})
+		require.EqualError(t, err, "tls cert and key files must be both set")
+
+		_, err = New(Options{TLS: &TLSConfig{CAFiles: []string{certFile + ".missing"}}})
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = New(Options{TLS: &TLSConfig{CAFiles: []string{keyFile}}})
+		require.EqualError(t, err, "tls: no certificates in "+keyFile)
+	})
+}
@@ -0,0 +1,51 @@
+package jsonclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	unixScheme = "unix://"
+	// unixHost is the host of the base url of the clients connected to a unix
+	// socket, sent in the Host header unless overridden by the Host option.
+	unixHost = "localhost"
+)
+
+// parseUnixBaseURL splits a base url as `unix:///var/run/agent.sock:/v1/` in
+// the socket path and the equivalent http base url. ok is false if the base
+// url has not the unix scheme.
+func parseUnixBaseURL(rawURL string) (baseURL, socket string, ok bool, err error) {
+	if !strings.HasPrefix(rawURL, unixScheme) {
+		return rawURL, "", false, nil
+	}
+	socket, path, _ := strings.Cut(strings.TrimPrefix(rawURL, unixScheme), ":")
+	if socket == "" {
+		return "", "", true, fmt.Errorf("unix base url without socket path")
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return "", "", true, fmt.Errorf("unix base url path should be absolute")
+	}
+	return unixBaseURL(path), socket, true, nil
+}
+
+// unixBaseURL returns the http base url of the path served by a unix socket.
+func unixBaseURL(path string) string {
+	return "http://" + unixHost + path
+}
+
+// unixSocketClient returns a copy of client which dials the unix socket for
+// all the requests.
+func unixSocketClient(client *http.Client, socket string) (*http.Client, error) {
+	dialer := &net.Dialer{}
+	return withTransport(client, "unix socket", func(transport *http.Transport) {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		transport.DialTLSContext = nil
+		transport.Proxy = nil
+	})
+}
@@ -0,0 +1,92 @@
+package jsonclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "jc")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"path": "` + req.URL.Path + `", "host": "` + req.Host + `"}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	type Response struct {
+		Path string `json:"path"`
+		Host string `json:"host"`
+	}
+	get := func(t *testing.T, client *Client, urlStr string) Response {
+		t.Helper()
+		req, err := client.NewRequest(http.MethodGet, urlStr, nil)
+		require.NoError(t, err)
+		var v Response
+		_, err = client.Do(req, &v)
+		require.NoError(t, err)
+		return v
+	}
+
+	t.Run("unix base url", func(t *testing.T) {
+		client, err := New(Options{BaseURL: "unix://" + socket + ":/v1"})
+		require.NoError(t, err)
+		require.Equal(t, "http://localhost/v1/", client.BaseURL.String())
+		require.Equal(t, Response{Path: "/v1/containers/json", Host: "localhost"}, get(t, client, "containers/json"))
+		require.Equal(t, Response{Path: "/ping", Host: "localhost"}, get(t, client, "/ping"))
+
+		client, err = New(Options{BaseURL: "unix://" + socket})
+		require.NoError(t, err)
+		require.Equal(t, Response{Path: "/ping", Host: "localhost"}, get(t, client, "ping"))
+	})
+
+	t.Run("unix socket option", func(t *testing.T) {
+		client, err := New(Options{BaseURL: "http://docker/v1.41/", UnixSocket: socket})
+		require.NoError(t, err)
+		require.Equal(t, Response{Path: "/v1.41/info", Host: "docker"}, get(t, client, "info"))
+
+		client, err = New(Options{UnixSocket: socket, Host: "agent"})
+		require.NoError(t, err)
+		require.Equal(t, Response{Path: "/info", Host: "agent"}, get(t, client, "info"))
+	})
+
+	t.Run("keeps the http client", func(t *testing.T) {
+		httpClient := &http.Client{Transport: &http.Transport{}}
+		client, err := New(Options{BaseURL: "unix://" + socket + ":/", HTTPClient: httpClient})
+		require.NoError(t, err)
+		require.Equal(t, Response{Path: "/info", Host: "localhost"}, get(t, client, "info"))
+		require.Nil(t, httpClient.Transport.(*http.Transport).DialContext)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := New(Options{BaseURL: "unix://:/v1/"})
+		require.EqualError(t, err, "unix base url without socket path")
+
+		_, err = New(Options{BaseURL: "unix://" + socket + ":v1/"})
+		require.EqualError(t, err, "unix base url path should be absolute")
+
+		_, err = New(Options{BaseURL: "unix://" + socket, UnixSocket: socket})
+		require.EqualError(t, err, "unix baseURL and unix socket cannot be both set")
+
+		_, err = New(Options{UnixSocket: socket, HTTPClient: &http.Client{Transport: roundTripperFunc(nil)}})
+		require.EqualError(t, err, "unix socket requires an *http.Transport, got jsonclient.roundTripperFunc")
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,430 @@
+package jsonclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TemplateVars map. A key/value map of variables used to expand an URI template.
+// Values could be strings (or any scalar, formatted with fmt), slices (lists)
+// or maps with string keys (associative arrays). Nil values, empty slices and
+// empty maps are considered undefined and are skipped during expansion.
+type TemplateVars map[string]interface{}
+
+// URITemplate is a parsed RFC 6570 URI template, supporting all the levels of
+// the specification (up to level 4).
+type URITemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	expr    *templateExpression
+}
+
+type templateExpression struct {
+	op       templateOperator
+	varspecs []templateVarspec
+}
+
+type templateVarspec struct {
+	name    string
+	explode bool
+	prefix  int
+}
+
+type templateOperator struct {
+	first         string
+	sep           string
+	named         bool
+	ifEmpty       string
+	allowReserved bool
+}
+
+var templateOperators = map[byte]templateOperator{
+	'+': {first: "", sep: ",", allowReserved: true},
+	'#': {first: "#", sep: ",", allowReserved: true},
+	'.': {first: ".", sep: "."},
+	'/': {first: "/", sep: "/"},
+	';': {first: ";", sep: ";", named: true},
+	'?': {first: "?", sep: "&", named: true, ifEmpty: "="},
+	'&': {first: "&", sep: "&", named: true, ifEmpty: "="},
+}
+
+var simpleTemplateOperator = templateOperator{first: "", sep: ","}
+
+// ParseURITemplate parses an RFC 6570 URI template.
+func ParseURITemplate(template string) (*URITemplate, error) {
+	t := &URITemplate{raw: template}
+
+	rest := template
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open == -1 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("uri template: unexpected '}' at offset %d", len(template)-len(rest)+open)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("uri template: unclosed expression at offset %d", len(template)-len(rest)+open)
+		}
+		expr, err := parseTemplateExpression(rest[open+1 : open+end])
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, templatePart{expr: expr})
+		rest = rest[open+end+1:]
+	}
+
+	return t, nil
+}
+
+func parseTemplateExpression(s string) (*templateExpression, error) {
+	if s == "" {
+		return nil, fmt.Errorf("uri template: empty expression")
+	}
+
+	expr := &templateExpression{op: simpleTemplateOperator}
+	if op, ok := templateOperators[s[0]]; ok {
+		expr.op = op
+		s = s[1:]
+	} else if strings.IndexByte("=,!@|", s[0]) != -1 {
+		return nil, fmt.Errorf("uri template: unsupported operator %q", s[0])
+	}
+
+	for _, spec := range strings.Split(s, ",") {
+		varspec := templateVarspec{name: spec}
+		if strings.HasSuffix(spec, "*") {
+			varspec.name = strings.TrimSuffix(spec, "*")
+			varspec.explode = true
+		} else if i := strings.IndexByte(spec, ':'); i != -1 {
+			varspec.name = spec[:i]
+			prefix, err := strconv.Atoi(spec[i+1:])
+			if err != nil || prefix <= 0 || prefix >= 10000 {
+				return nil, fmt.Errorf("uri template: invalid prefix in %q", spec)
+			}
+			varspec.prefix = prefix
+		}
+		if !isValidTemplateVarname(varspec.name) {
+			return nil, fmt.Errorf("uri template: invalid variable name %q", varspec.name)
+		}
+		expr.varspecs = append(expr.varspecs, varspec)
+	}
+
+	return expr, nil
+}
+
+func isValidTemplateVarname(name string) bool {
+	if name == "" || name[0] == '.' || name[len(name)-1] == '.' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case isAlphaNum(c), c == '_':
+		case c == '.':
+			if name[i-1] == '.' {
+				return false
+			}
+		case c == '%':
+			if i+2 >= len(name) || !isHex(name[i+1]) || !isHex(name[i+2]) {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the unexpanded template.
+func (t *URITemplate) String() string {
+	return t.raw
+}
+
+// Expand expands the template with the passed variables.
+func (t *URITemplate) Expand(vars TemplateVars) (string, error) {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.expr == nil {
+			b.WriteString(encodeTemplateValue(part.literal, true))
+			continue
+		}
+		if err := part.expr.expand(&b, vars); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *templateExpression) expand(b *strings.Builder, vars TemplateVars) error {
+	first := true
+	for _, spec := range e.varspecs {
+		value, kind := templateValueOf(vars[spec.name])
+		if kind == templateUndefined {
+			continue
+		}
+
+		if first {
+			b.WriteString(e.op.first)
+			first = false
+		} else {
+			b.WriteString(e.op.sep)
+		}
+
+		switch kind {
+		case templateString:
+			s := value.(string)
+			if e.op.named {
+				b.WriteString(spec.name)
+				if s == "" {
+					b.WriteString(e.op.ifEmpty)
+					continue
+				}
+				b.WriteByte('=')
+			}
+			if spec.prefix > 0 {
+				s = truncateRunes(s, spec.prefix)
+			}
+			b.WriteString(encodeTemplateValue(s, e.op.allowReserved))
+		case templateList, templateMap:
+			if spec.prefix > 0 {
+				return fmt.Errorf("uri template: prefix modifier not applicable to composite variable %q", spec.name)
+			}
+			if spec.explode {
+				e.expandExploded(b, spec, value, kind)
+			} else {
+				e.expandComposite(b, spec, value, kind)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *templateExpression) expandComposite(b *strings.Builder, spec templateVarspec, value interface{}, kind templateValueKind) {
+	if e.op.named {
+		b.WriteString(spec.name)
+		b.WriteByte('=')
+	}
+	var items []string
+	if kind == templateList {
+		for _, item := range value.([]string) {
+			items = append(items, encodeTemplateValue(item, e.op.allowReserved))
+		}
+	} else {
+		for _, pair := range value.([][2]string) {
+			items = append(items,
+				encodeTemplateValue(pair[0], e.op.allowReserved),
+				encodeTemplateValue(pair[1], e.op.allowReserved),
+			)
+		}
+	}
+	b.WriteString(strings.Join(items, ","))
+}
+
+func (e *templateExpression) expandExploded(b *strings.Builder, spec templateVarspec, value interface{}, kind templateValueKind) {
+	var pairs [][2]string
+	if kind == templateList {
+		for _, item := range value.([]string) {
+			pairs = append(pairs, [2]string{spec.name, item})
+		}
+	} else {
+		pairs = value.([][2]string)
+	}
+
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteString(e.op.sep)
+		}
+		name, v := pair[0], pair[1]
+		if kind == templateMap {
+			name = encodeTemplateValue(name, e.op.allowReserved)
+		}
+		switch {
+		case e.op.named:
+			b.WriteString(name)
+			if v == "" {
+				b.WriteString(e.op.ifEmpty)
+				continue
+			}
+			b.WriteByte('=')
+		case kind == templateMap:
+			b.WriteString(name)
+			b.WriteByte('=')
+		}
+		b.WriteString(encodeTemplateValue(v, e.op.allowReserved))
+	}
+}
+
+type templateValueKind int
+
+const (
+	templateUndefined templateValueKind = iota
+	templateString
+	templateList
+	templateMap
+)
+
+// templateValueOf normalizes a variable value to a string, a list of strings
+// or a list of key/value pairs sorted by key.
+func templateValueOf(v interface{}) (interface{}, templateValueKind) {
+	if v == nil {
+		return nil, templateUndefined
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, templateUndefined
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), templateString
+		}
+		if rv.Len() == 0 {
+			return nil, templateUndefined
+		}
+		items := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, formatTemplateScalar(rv.Index(i)))
+		}
+		return items, templateList
+	case reflect.Map:
+		if rv.Len() == 0 {
+			return nil, templateUndefined
+		}
+		pairs := make([][2]string, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, [2]string{formatTemplateScalar(iter.Key()), formatTemplateScalar(iter.Value())})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+		return pairs, templateMap
+	default:
+		return formatTemplateScalar(rv), templateString
+	}
+}
+
+func formatTemplateScalar(rv reflect.Value) string {
+	if rv.Kind() == reflect.String {
+		return rv.String()
+	}
+	if rv.CanInterface() {
+		if s, ok := rv.Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+		return fmt.Sprint(rv.Interface())
+	}
+	return fmt.Sprint(rv)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
+
+const upperHex = "0123456789ABCDEF"
+
+// encodeTemplateValue percent-encodes every character not in the unreserved
+// set. If allowReserved is true, reserved characters and already
+// pct-encoded triplets are kept as is.
+func encodeTemplateValue(s string, allowReserved bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isUnreserved(c):
+			b.WriteByte(c)
+		case allowReserved && isReserved(c):
+			b.WriteByte(c)
+		case allowReserved && c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteString(s[i : i+3])
+			i += 2
+		default:
+			b.WriteByte('%')
+			b.WriteByte(upperHex[c>>4])
+			b.WriteByte(upperHex[c&15])
+		}
+	}
+	return b.String()
+}
+
+func isAlphaNum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isUnreserved(c byte) bool {
+	return isAlphaNum(c) || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isReserved(c byte) bool {
+	return strings.IndexByte(":/?#[]@!$&'()*+,;=", c) != -1
+}
+
+type uriTemplateKey struct{}
+
+type uriTemplateVarsKey struct{}
+
+// URITemplateFromRequest returns the unexpanded URI template used to create
+// the request, if the request was created with NewTemplateRequestWithContext.
+// It could be useful to label metrics and logs without high cardinality paths.
+func URITemplateFromRequest(req *http.Request) (string, bool) {
+	template, ok := req.Context().Value(uriTemplateKey{}).(string)
+	return template, ok
+}
+
+// NewTemplateRequestWithContext function works like NewRequestWithContext, but
+// the request url is built expanding the RFC 6570 `template` with `vars`.
+// All the variables are correctly escaped, so it is not required to escape
+// them before.
+// The unexpanded template is kept in the request context, and it could be
+// retrieved using URITemplateFromRequest.
+func (c *Client) NewTemplateRequestWithContext(ctx context.Context, method string, template string, vars TemplateVars, body interface{}, opts ...RequestOption) (*http.Request, error) {
+	t, err := ParseURITemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	urlStr, err := t.Expand(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, uriTemplateKey{}, template)
+	ctx = context.WithValue(ctx, uriTemplateVarsKey{}, vars)
+	return c.NewRequestWithContext(ctx, method, urlStr, body, opts...)
+}
+
+// NewTemplateRequest function is same of NewTemplateRequestWithContext, without context
+func (c *Client) NewTemplateRequest(method, template string, vars TemplateVars, body interface{}, opts ...RequestOption) (*http.Request, error) {
+	return c.NewTemplateRequestWithContext(context.Background(), method, template, vars, body, opts...)
+}
@@ -0,0 +1,176 @@
+package jsonclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestURITemplate(t *testing.T) {
+	vars := TemplateVars{
+		"count":      []string{"one", "two", "three"},
+		"dom":        []string{"example", "com"},
+		"dub":        "me/too",
+		"hello":      "Hello World!",
+		"half":       "50%",
+		"var":        "value",
+		"who":        "fred",
+		"base":       "http://example.com/home/",
+		"path":       "/foo/bar",
+		"list":       []string{"red", "green", "blue"},
+		"keys":       map[string]string{"semi": ";", "dot": ".", "comma": ","},
+		"v":          "6",
+		"x":          "1024",
+		"y":          "768",
+		"empty":      "",
+		"empty_keys": map[string]string{},
+		"undef":      nil,
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		// Level 1
+		{"{var}", "value"},
+		{"{hello}", "Hello%20World%21"},
+		// Level 2
+		{"{+var}", "value"},
+		{"{+hello}", "Hello%20World!"},
+		{"{+path}/here", "/foo/bar/here"},
+		{"here?ref={+path}", "here?ref=/foo/bar"},
+		{"X{#var}", "X#value"},
+		{"X{#hello}", "X#Hello%20World!"},
+		{"{+half}", "50%25"},
+		// Level 3
+		{"map?{x,y}", "map?1024,768"},
+		{"{x,hello,y}", "1024,Hello%20World%21,768"},
+		{"{+x,hello,y}", "1024,Hello%20World!,768"},
+		{"{+path,x}/here", "/foo/bar,1024/here"},
+		{"{#x,hello,y}", "#1024,Hello%20World!,768"},
+		{"{#path,x}/here", "#/foo/bar,1024/here"},
+		{"X{.var}", "X.value"},
+		{"X{.x,y}", "X.1024.768"},
+		{"{/var}", "/value"},
+		{"{/var,x}/here", "/value/1024/here"},
+		{"{;x,y}", ";x=1024;y=768"},
+		{"{;x,y,empty}", ";x=1024;y=768;empty"},
+		{"{?x,y}", "?x=1024&y=768"},
+		{"{?x,y,empty}", "?x=1024&y=768&empty="},
+		{"?fixed=yes{&x}", "?fixed=yes&x=1024"},
+		{"{&x,y,empty}", "&x=1024&y=768&empty="},
+		// Level 4
+		{"{var:3}", "val"},
+		{"{var:30}", "value"},
+		{"{list}", "red,green,blue"},
+		{"{list*}", "red,green,blue"},
+		{"{keys}", "comma,%2C,dot,.,semi,%3B"},
+		{"{keys*}", "comma=%2C,dot=.,semi=%3B"},
+		{"{+path:6}/here", "/foo/b/here"},
+		{"{+list}", "red,green,blue"},
+		{"{+list*}", "red,green,blue"},
+		{"{+keys}", "comma,,,dot,.,semi,;"},
+		{"{+keys*}", "comma=,,dot=.,semi=;"},
+		{"{#path:6}/here", "#/foo/b/here"},
+		{"{#list}", "#red,green,blue"},
+		{"{#list*}", "#red,green,blue"},
+		{"{#keys*}", "#comma=,,dot=.,semi=;"},
+		{"X{.var:3}", "X.val"},
+		{"X{.list}", "X.red,green,blue"},
+		{"X{.list*}", "X.red.green.blue"},
+		{"X{.keys*}", "X.comma=%2C.dot=..semi=%3B"},
+		{"{/var:1,var}", "/v/value"},
+		{"{/list}", "/red,green,blue"},
+		{"{/list*}", "/red/green/blue"},
+		{"{/list*,path:4}", "/red/green/blue/%2Ffoo"},
+		{"{/keys*}", "/comma=%2C/dot=./semi=%3B"},
+		{"{;hello:5}", ";hello=Hello"},
+		{"{;list}", ";list=red,green,blue"},
+		{"{;list*}", ";list=red;list=green;list=blue"},
+		{"{;keys*}", ";comma=%2C;dot=.;semi=%3B"},
+		{"{?var:3}", "?var=val"},
+		{"{?list}", "?list=red,green,blue"},
+		{"{?list*}", "?list=red&list=green&list=blue"},
+		{"{?keys}", "?keys=comma,%2C,dot,.,semi,%3B"},
+		{"{?keys*}", "?comma=%2C&dot=.&semi=%3B"},
+		{"{&var:3}", "&var=val"},
+		{"{&list*}", "&list=red&list=green&list=blue"},
+		// Undefined values
+		{"{undef}", ""},
+		{"{?undef,empty_keys}", ""},
+		{"{?undef,var}", "?var=value"},
+		{"users/{dub}/orders", "users/me%2Ftoo/orders"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			tmpl, err := ParseURITemplate(test.template)
+			require.NoError(t, err)
+			require.Equal(t, test.template, tmpl.String())
+
+			expanded, err := tmpl.Expand(vars)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, expanded)
+		})
+	}
+
+	t.Run("supports not string values", func(t *testing.T) {
+		tmpl, err := ParseURITemplate("items/{id}{?limit,ids}")
+		require.NoError(t, err)
+
+		expanded, err := tmpl.Expand(TemplateVars{"id": 42, "limit": 10, "ids": []int{1, 2}})
+		require.NoError(t, err)
+		require.Equal(t, "items/42?limit=10&ids=1,2", expanded)
+	})
+
+	t.Run("throws on invalid templates", func(t *testing.T) {
+		for _, template := range []string{"{var", "var}", "{}", "{=var}", "{var:0}", "{var:abc}", "{va r}", "{.}"} {
+			_, err := ParseURITemplate(template)
+			require.Error(t, err, template)
+		}
+	})
+
+	t.Run("throws using prefix on composite values", func(t *testing.T) {
+		tmpl, err := ParseURITemplate("{list:2}")
+		require.NoError(t, err)
+
+		_, err = tmpl.Expand(vars)
+		require.EqualError(t, err, `uri template: prefix modifier not applicable to composite variable "list"`)
+	})
+}
+
+func TestNewTemplateRequestWithContext(t *testing.T) {
+	client, err := New(Options{BaseURL: apiURL})
+	require.NoError(t, err, "create client error")
+
+	t.Run("correctly expand template and keep it in request", func(t *testing.T) {
+		template := "users/{id}/orders{?status,limit}"
+		req, err := client.NewTemplateRequestWithContext(context.Background(), http.MethodGet, template, TemplateVars{
+			"id":     "a/b?c",
+			"status": "open",
+			"limit":  10,
+		}, nil)
+		require.NoError(t, err)
+
+		require.Equal(t, "https://base-url:8080/api/url/users/a%2Fb%3Fc/orders?status=open&limit=10", req.URL.String())
+		requestTemplate, ok := URITemplateFromRequest(req)
+		require.True(t, ok)
+		require.Equal(t, template, requestTemplate)
+	})
+
+	t.Run("throws if template is not valid", func(t *testing.T) {
+		req, err := client.NewTemplateRequest(http.MethodGet, "users/{id", nil, nil)
+		require.EqualError(t, err, "uri template: unclosed expression at offset 6")
+		require.Nil(t, req)
+	})
+
+	t.Run("request without template", func(t *testing.T) {
+		req, err := client.NewRequest(http.MethodGet, "users", nil)
+		require.NoError(t, err)
+
+		_, ok := URITemplateFromRequest(req)
+		require.False(t, ok)
+	})
+}
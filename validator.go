@@ -0,0 +1,192 @@
+package jsonclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrSchemaValidation define a schema validation error
+var ErrSchemaValidation = errors.New("schema validation error")
+
+// Directions of a validated body
+const (
+	ValidationRequest  = "request"
+	ValidationResponse = "response"
+)
+
+// SchemaValidationError struct define a request or response body not valid
+// against the schema registered for its route.
+type SchemaValidationError struct {
+	Method     string
+	URL        string
+	Direction  string
+	Violations []SchemaViolation
+	Err        error
+}
+
+func (e *SchemaValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.String())
+	}
+	return fmt.Sprintf("%s %s: %s body does not match schema: %s",
+		e.Method,
+		e.URL,
+		e.Direction,
+		strings.Join(messages, "; "),
+	)
+}
+
+func (e *SchemaValidationError) Unwrap() error {
+	return e.Err
+}
+
+// RouteSchemas contains the schemas used to validate the request body and the
+// successful response body of a route. Both are optional.
+type RouteSchemas struct {
+	Request  *Schema
+	Response *Schema
+}
+
+type schemaRoute struct {
+	method   string
+	segments []string
+	schemas  RouteSchemas
+}
+
+// SchemaValidator validates request and response bodies against JSON Schemas
+// registered per route.
+// By default (strict mode) a violation makes NewRequestWithContext or Do fail
+// with a SchemaValidationError. If WarnOnly is true, violations are only
+// passed to OnViolation.
+type SchemaValidator struct {
+	WarnOnly    bool
+	OnViolation func(err *SchemaValidationError)
+
+	mtx    sync.RWMutex
+	routes []schemaRoute
+}
+
+// Register the schemas of a route.
+// Method could be empty to match all the methods. Pattern is the path of the
+// request, relative to the client BaseURL, where a segment in the form
+// `{name}` matches any segment (e.g. `users/{id}/orders`).
+func (v *SchemaValidator) Register(method, pattern string, schemas RouteSchemas) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	v.routes = append(v.routes, schemaRoute{
+		method:   strings.ToUpper(method),
+		segments: splitPath(pattern),
+		schemas:  schemas,
+	})
+}
+
+func (v *SchemaValidator) match(method, path string) (RouteSchemas, bool) {
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+
+	segments := splitPath(path)
+	for _, route := range v.routes {
+		if route.method != "" && route.method != method {
+			continue
+		}
+		if matchSegments(route.segments, segments) {
+			return route.schemas, true
+		}
+	}
+	return RouteSchemas{}, false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// validate returns an error only in strict mode.
+func (v *SchemaValidator) validate(req *http.Request, basePath, direction string, data []byte) error {
+	schemas, ok := v.match(req.Method, relativePath(req, basePath))
+	if !ok {
+		return nil
+	}
+	schema := schemas.Request
+	if direction == ValidationResponse {
+		schema = schemas.Response
+	}
+	if schema == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	violations, err := schema.ValidateJSON(data)
+	if err != nil {
+		violations = []SchemaViolation{{Message: fmt.Sprintf("invalid json: %s", err)}}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	validationErr := &SchemaValidationError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Direction:  direction,
+		Violations: violations,
+		Err:        ErrSchemaValidation,
+	}
+	if v.OnViolation != nil {
+		v.OnViolation(validationErr)
+	}
+	if v.WarnOnly {
+		return nil
+	}
+	return validationErr
+}
+
+func (v *SchemaValidator) validateRequest(req *http.Request, basePath string, body []byte) error {
+	return v.validate(req, basePath, ValidationRequest, body)
+}
+
+// validateResponse reads the whole response body, if the route has a response
+// schema, replacing it with a buffered copy to be decoded. The route is matched on req, the request built by the
+// client, since the request sent could target another endpoint.
+func (v *SchemaValidator) validateResponse(req *http.Request, resp *http.Response, basePath string) error {
+	if schemas, ok := v.match(req.Method, relativePath(req, basePath)); !ok || schemas.Response == nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return v.validate(req, basePath, ValidationResponse, data)
+}
+
+func relativePath(req *http.Request, basePath string) string {
+	path := req.URL.EscapedPath()
+	if basePath != "" && basePath != "/" && strings.HasPrefix(path, basePath) {
+		return strings.TrimPrefix(path, basePath)
+	}
+	return path
+}
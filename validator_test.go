@@ -0,0 +1,154 @@
+package jsonclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	userSchema := MustCompileSchema([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {"name": {"type": "string"}, "age": {"type": "integer", "minimum": 0}}
+	}`))
+
+	setupServer := func(responseBody string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(200)
+			w.Write([]byte(responseBody))
+		}))
+	}
+
+	newClient := func(t *testing.T, baseURL string, validator *SchemaValidator) *Client {
+		client, err := New(Options{BaseURL: baseURL, SchemaValidator: validator})
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("throws with not valid request body in strict mode", func(t *testing.T) {
+		validator := &SchemaValidator{}
+		validator.Register(http.MethodPost, "users/{id}", RouteSchemas{Request: userSchema})
+		client := newClient(t, apiURL, validator)
+
+		req, err := client.NewRequest(http.MethodPost, "users/1", map[string]interface{}{"age": -1})
+		require.Nil(t, req)
+		require.EqualError(t, err, `POST https://base-url:8080/api/url/users/1: request body does not match schema: /: missing required property "name"; /age: must be >= 0`)
+
+		var validationErr *SchemaValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.True(t, errors.Is(err, ErrSchemaValidation))
+		require.Equal(t, ValidationRequest, validationErr.Direction)
+		require.Equal(t, []SchemaViolation{
+			{InstancePath: "", SchemaPath: "/required", Message: `missing required property "name"`},
+			{InstancePath: "/age", SchemaPath: "/properties/age/minimum", Message: "must be >= 0"},
+		}, validationErr.Violations)
+	})
+
+	t.Run("does not validate not matching routes", func(t *testing.T) {
+		validator := &SchemaValidator{}
+		validator.Register(http.MethodPost, "users/{id}", RouteSchemas{Request: userSchema})
+		client := newClient(t, apiURL, validator)
+
+		_, err := client.NewRequest(http.MethodPut, "users/1", map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = client.NewRequest(http.MethodPost, "users/1/orders", map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = client.NewRequest(http.MethodPost, "users/1", map[string]interface{}{"name": "john"})
+		require.NoError(t, err)
+	})
+
+	t.Run("calls OnViolation in warn only mode", func(t *testing.T) {
+		var violations []*SchemaValidationError
+		validator := &SchemaValidator{
+			WarnOnly: true,
+			OnViolation: func(err *SchemaValidationError) {
+				violations = append(violations, err)
+			},
+		}
+		validator.Register("", "users", RouteSchemas{Request: userSchema})
+		client := newClient(t, apiURL, validator)
+
+		req, err := client.NewRequest(http.MethodPost, "users", map[string]interface{}{"name": 1})
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		require.Len(t, violations, 1)
+		require.Equal(t, "/name", violations[0].Violations[0].InstancePath)
+	})
+
+	t.Run("throws with not valid response body", func(t *testing.T) {
+		s := setupServer(`{"age": "old"}`)
+		defer s.Close()
+
+		validator := &SchemaValidator{}
+		validator.Register(http.MethodGet, "users/{id}", RouteSchemas{Response: userSchema})
+		client := newClient(t, fmt.Sprintf("%s/api/", s.URL), validator)
+
+		req, err := client.NewRequest(http.MethodGet, "users/1", nil)
+		require.NoError(t, err)
+
+		v := map[string]interface{}{}
+		resp, err := client.Do(req, &v)
+		require.Nil(t, resp)
+		require.Empty(t, v)
+		var validationErr *SchemaValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.Equal(t, ValidationResponse, validationErr.Direction)
+		require.Equal(t, []SchemaViolation{
+			{InstancePath: "", SchemaPath: "/required", Message: `missing required property "name"`},
+			{InstancePath: "/age", SchemaPath: "/properties/age/type", Message: "expected type integer, got string"},
+		}, validationErr.Violations)
+	})
+
+	t.Run("decodes valid response body", func(t *testing.T) {
+		s := setupServer(`{"name": "john", "age": 3}`)
+		defer s.Close()
+
+		validator := &SchemaValidator{}
+		validator.Register(http.MethodGet, "users/{id}", RouteSchemas{Response: userSchema})
+		client := newClient(t, fmt.Sprintf("%s/api/", s.URL), validator)
+
+		req, err := client.NewRequest(http.MethodGet, "users/1", nil)
+		require.NoError(t, err)
+
+		v := struct {
+			Name string `json:"name"`
+		}{}
+		resp, err := client.Do(req, &v)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, "john", v.Name)
+	})
+
+	t.Run("reports response not json as violation", func(t *testing.T) {
+		s := setupServer(`not json`)
+		defer s.Close()
+
+		validator := &SchemaValidator{}
+		validator.Register(http.MethodGet, "users", RouteSchemas{Response: userSchema})
+		client := newClient(t, fmt.Sprintf("%s/", s.URL), validator)
+
+		req, err := client.NewRequest(http.MethodGet, "users", nil)
+		require.NoError(t, err)
+
+		_, err = client.Do(req, nil)
+		require.ErrorIs(t, err, ErrSchemaValidation)
+	})
+
+	t.Run("does not buffer the response body without response schema", func(t *testing.T) {
+		validator := &SchemaValidator{}
+		validator.Register(http.MethodPost, "users", RouteSchemas{Request: userSchema})
+
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		body := io.NopCloser(strings.NewReader(`not json`))
+		resp := &http.Response{StatusCode: 200, Body: body}
+		require.NoError(t, validator.validateResponse(req, resp, "/"))
+		require.Equal(t, body, resp.Body)
+	})
+}